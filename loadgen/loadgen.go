@@ -0,0 +1,273 @@
+// Package loadgen writes synthetic log records into a Kinesis stream, so that the capacity of the
+// consumer and its Firehose can be measured repeatably.
+package loadgen
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	iface "github.com/aws/aws-sdk-go/service/kinesis/kinesisiface"
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+)
+
+var log = logger.New("kinesis-to-firehose-loadgen")
+
+// maxPutRecords is the most records Kinesis accepts in one PutRecords call
+const maxPutRecords = 500
+
+// Record formats
+const (
+	// FormatKayvee is one rsyslog-prefixed Kayvee line per Kinesis record
+	FormatKayvee = "kayvee"
+	// FormatCWLogs is a gzipped CloudWatch Logs subscription batch per Kinesis record
+	FormatCWLogs = "cwlogs"
+	// FormatKPL is a KPL aggregate of rsyslog-prefixed Kayvee lines per Kinesis record
+	FormatKPL = "kpl"
+)
+
+// Config is the set of options for a load test
+type Config struct {
+	// StreamName is the Kinesis stream to write to
+	StreamName string
+	// Region is the region in which the stream exists
+	Region string
+	// Format is the record format: FormatKayvee, FormatCWLogs, or FormatKPL
+	Format string
+	// Rate is the number of Kinesis records to write per second
+	Rate int
+	// Duration is how long to write records for
+	Duration time.Duration
+	// MinSize and MaxSize bound the size in bytes of each log's payload. Sizes are uniformly
+	// distributed between them.
+	MinSize int
+	MaxSize int
+	// EventsPerRecord is the number of log events in each CloudWatch Logs batch or KPL aggregate
+	EventsPerRecord int
+	// Apps is the number of distinct apps to spread logs across
+	Apps int
+}
+
+// Run parses args (the arguments after the "loadgen" subcommand) and runs a load test
+func Run(args []string) error {
+	config := Config{}
+	flags := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	flags.StringVar(&config.StreamName, "stream", "", "Kinesis stream to write to (required)")
+	flags.StringVar(&config.Region, "region", "us-west-1", "region of the Kinesis stream")
+	flags.StringVar(&config.Format, "format", FormatKayvee, "record format: kayvee, cwlogs, or kpl")
+	flags.IntVar(&config.Rate, "rate", 100, "Kinesis records per second")
+	flags.DurationVar(&config.Duration, "duration", time.Minute, "how long to write records for")
+	flags.IntVar(&config.MinSize, "min-size", 100, "minimum payload size in bytes")
+	flags.IntVar(&config.MaxSize, "max-size", 1000, "maximum payload size in bytes")
+	flags.IntVar(&config.EventsPerRecord, "events", 50, "log events per cwlogs or kpl record")
+	flags.IntVar(&config.Apps, "apps", 20, "number of distinct apps")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if config.StreamName == "" {
+		return fmt.Errorf("-stream is required")
+	}
+	if config.Format != FormatKayvee && config.Format != FormatCWLogs && config.Format != FormatKPL {
+		return fmt.Errorf("-format must be %s, %s, or %s", FormatKayvee, FormatCWLogs, FormatKPL)
+	}
+	if config.Rate <= 0 || config.Apps <= 0 || config.EventsPerRecord <= 0 {
+		return fmt.Errorf("-rate, -apps, and -events must be positive")
+	}
+	if config.MinSize < 0 || config.MaxSize < config.MinSize {
+		return fmt.Errorf("-max-size must be at least -min-size")
+	}
+
+	sess := session.Must(session.NewSession(aws.NewConfig().WithRegion(config.Region)))
+	return generate(config, kinesis.New(sess), rand.New(rand.NewSource(time.Now().UnixNano())))
+}
+
+// generate writes config.Rate records to the stream every second until config.Duration is up
+func generate(config Config, client iface.KinesisAPI, rng *rand.Rand) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	deadline := time.Now().Add(config.Duration)
+	sent, failed := 0, 0
+	for now := range ticker.C {
+		if now.After(deadline) {
+			break
+		}
+
+		entries := make([]*kinesis.PutRecordsRequestEntry, config.Rate)
+		for idx := range entries {
+			entries[idx] = &kinesis.PutRecordsRequestEntry{
+				Data:         newRecord(config, rng, now),
+				PartitionKey: aws.String(strconv.FormatInt(rng.Int63(), 10)),
+			}
+		}
+
+		for len(entries) > 0 {
+			chunk := entries
+			if len(chunk) > maxPutRecords {
+				chunk = chunk[:maxPutRecords]
+			}
+			entries = entries[len(chunk):]
+
+			res, err := client.PutRecords(&kinesis.PutRecordsInput{
+				StreamName: aws.String(config.StreamName),
+				Records:    chunk,
+			})
+			if err != nil {
+				return err
+			}
+			sent += len(chunk)
+			failed += int(aws.Int64Value(res.FailedRecordCount))
+		}
+
+		log.InfoD("loadgen-progress", logger.M{"stream": config.StreamName, "sent": sent, "failed": failed})
+	}
+
+	return nil
+}
+
+// newRecord builds one Kinesis record in the configured format
+func newRecord(config Config, rng *rand.Rand, now time.Time) []byte {
+	app := fmt.Sprintf("loadgen-app-%d", rng.Intn(config.Apps))
+	switch config.Format {
+	case FormatKayvee:
+		return []byte(kayveeLine(app, payload(config, rng), now))
+	case FormatKPL:
+		return kplAggregate(config, rng, app, now)
+	}
+	return cwlogsBatch(config, rng, app, now)
+}
+
+// payload returns a Kayvee JSON payload of roughly the configured size
+func payload(config Config, rng *rand.Rand) string {
+	size := config.MinSize
+	if config.MaxSize > config.MinSize {
+		size += rng.Intn(config.MaxSize - config.MinSize + 1)
+	}
+
+	levels := []string{"debug", "info", "info", "info", "warning", "error"}
+	fields := map[string]interface{}{
+		"title":  "loadgen-event",
+		"source": "loadgen",
+		"level":  levels[rng.Intn(len(levels))],
+		"value":  rng.Intn(1000),
+	}
+	base, _ := json.Marshal(fields)
+	if pad := size - len(base) - len(`,"padding":""`); pad > 0 {
+		fields["padding"] = strings.Repeat("x", pad)
+	}
+
+	line, _ := json.Marshal(fields)
+	return string(line)
+}
+
+// rsyslogTimestamp is the high-precision timestamp format of RSYSLOG_FileFormat, which decode
+// requires. time.RFC3339Nano isn't accepted, since it trims trailing zeros and writes UTC as "Z".
+const rsyslogTimestamp = "2006-01-02T15:04:05.000000-07:00"
+
+// kayveeLine formats a payload the way rsyslog writes ECS container logs
+func kayveeLine(app, payload string, now time.Time) string {
+	return fmt.Sprintf("%s ip-10-0-0-1 production--%s/arn%%3Aaws%%3Aecs%%3Aus-west-1%%3A"+
+		"999988887777%%3Atask%%2F12345678-1234-1234-1234-555566667777[1]: %s",
+		now.UTC().Format(rsyslogTimestamp), app, payload)
+}
+
+// cwLogEvent and cwLogBatch mirror a CloudWatch Logs subscription record
+type cwLogEvent struct {
+	ID        string `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+}
+
+type cwLogBatch struct {
+	MessageType         string       `json:"messageType"`
+	Owner               string       `json:"owner"`
+	LogGroup            string       `json:"logGroup"`
+	LogStream           string       `json:"logStream"`
+	SubscriptionFilters []string     `json:"subscriptionFilters"`
+	LogEvents           []cwLogEvent `json:"logEvents"`
+}
+
+// cwlogsBatch builds a gzipped CloudWatch Logs subscription batch for app
+func cwlogsBatch(config Config, rng *rand.Rand, app string, now time.Time) []byte {
+	batch := cwLogBatch{
+		MessageType:         "DATA_MESSAGE",
+		Owner:               "999988887777",
+		LogGroup:            "/aws/batch/job",
+		LogStream:           fmt.Sprintf("production--%s/default/%016x", app, rng.Int63()),
+		SubscriptionFilters: []string{"loadgen"},
+	}
+	for idx := 0; idx < config.EventsPerRecord; idx++ {
+		batch.LogEvents = append(batch.LogEvents, cwLogEvent{
+			ID:        strconv.FormatInt(rng.Int63(), 10),
+			Timestamp: now.UnixNano() / int64(time.Millisecond),
+			Message:   payload(config, rng),
+		})
+	}
+
+	data, _ := json.Marshal(batch)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+// kplMagic prefixes every KPL aggregated record
+var kplMagic = []byte{0xf3, 0x89, 0x9a, 0xc2}
+
+// kplAggregate builds a KPL aggregated record of config.EventsPerRecord Kayvee lines for app,
+// which the KCL deaggregates before the consumer sees them. The format is the magic number, an
+// AggregatedRecord protobuf, and the MD5 of the protobuf:
+//
+//	message AggregatedRecord {
+//	  repeated string partition_key_table = 1;
+//	  repeated Record records = 3;
+//	}
+//	message Record {
+//	  required uint64 partition_key_index = 1;
+//	  required bytes data = 3;
+//	}
+func kplAggregate(config Config, rng *rand.Rand, app string, now time.Time) []byte {
+	aggregate := protoBytes(nil, 1, []byte(strconv.FormatInt(rng.Int63(), 10)))
+	for idx := 0; idx < config.EventsPerRecord; idx++ {
+		record := protoVarint(nil, 1, 0)
+		record = protoBytes(record, 3, []byte(kayveeLine(app, payload(config, rng), now)))
+		aggregate = protoBytes(aggregate, 3, record)
+	}
+
+	sum := md5.Sum(aggregate)
+	out := append([]byte{}, kplMagic...)
+	out = append(out, aggregate...)
+	return append(out, sum[:]...)
+}
+
+// protoVarint appends a varint field to a protobuf message
+func protoVarint(msg []byte, field int, val uint64) []byte {
+	msg = appendUvarint(msg, uint64(field<<3))
+	return appendUvarint(msg, val)
+}
+
+// protoBytes appends a length-delimited field to a protobuf message
+func protoBytes(msg []byte, field int, val []byte) []byte {
+	msg = appendUvarint(msg, uint64(field<<3|2))
+	msg = appendUvarint(msg, uint64(len(val)))
+	return append(msg, val...)
+}
+
+// appendUvarint appends val to buf as a protobuf varint
+func appendUvarint(buf []byte, val uint64) []byte {
+	varint := make([]byte, binary.MaxVarintLen64)
+	return append(buf, varint[:binary.PutUvarint(varint, val)]...)
+}
@@ -0,0 +1,119 @@
+package loadgen
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/Clever/amazon-kinesis-client-go/decode"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Clever/kinesis-to-firehose/mocks"
+)
+
+var testConfig = Config{
+	StreamName:      "test-stream",
+	Format:          FormatKayvee,
+	Rate:            600,
+	Duration:        1500 * time.Millisecond,
+	MinSize:         200,
+	MaxSize:         400,
+	EventsPerRecord: 10,
+	Apps:            5,
+}
+
+func TestKayveeRecord(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		fields, err := decode.ParseAndEnhance(string(newRecord(testConfig, rng, time.Now())), "test")
+		require.NoError(t, err)
+		assert.Equal(t, "loadgen-event", fields["title"])
+		assert.Contains(t, fields["container_app"], "loadgen-app-")
+	}
+}
+
+func TestPayloadSize(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		size := len(payload(testConfig, rng))
+		assert.True(t, size >= testConfig.MinSize && size <= testConfig.MaxSize, size)
+	}
+}
+
+func TestCWLogsRecord(t *testing.T) {
+	config := testConfig
+	config.Format = FormatCWLogs
+
+	record := newRecord(config, rand.New(rand.NewSource(1)), time.Now())
+	zr, err := gzip.NewReader(bytes.NewReader(record))
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(zr)
+	assert.NoError(t, err)
+
+	batch := cwLogBatch{}
+	assert.NoError(t, json.Unmarshal(data, &batch))
+	assert.Equal(t, "DATA_MESSAGE", batch.MessageType)
+	assert.Len(t, batch.LogEvents, config.EventsPerRecord)
+}
+
+func TestKPLRecord(t *testing.T) {
+	config := testConfig
+	config.Format = FormatKPL
+
+	record := newRecord(config, rand.New(rand.NewSource(1)), time.Now())
+	require.True(t, bytes.HasPrefix(record, kplMagic))
+	aggregate := record[len(kplMagic) : len(record)-md5.Size]
+	sum := md5.Sum(aggregate)
+	assert.Equal(t, sum[:], record[len(record)-md5.Size:])
+
+	// Walk the AggregatedRecord's fields, decoding each Record's data
+	lines := 0
+	for len(aggregate) > 0 {
+		key, n := binary.Uvarint(aggregate)
+		length, m := binary.Uvarint(aggregate[n:])
+		val := aggregate[n+m : n+m+int(length)]
+		aggregate = aggregate[n+m+int(length):]
+		if key != 3<<3|2 {
+			continue
+		}
+
+		_, n = binary.Uvarint(val[1:]) // partition_key_index
+		data := val[1+n:]
+		require.Equal(t, byte(3<<3|2), data[0])
+		length, m = binary.Uvarint(data[1:])
+		fields, err := decode.ParseAndEnhance(string(data[1+m:1+m+int(length)]), "test")
+		require.NoError(t, err)
+		assert.Equal(t, "loadgen-event", fields["title"])
+		lines++
+	}
+	assert.Equal(t, config.EventsPerRecord, lines)
+}
+
+func TestGenerate(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockKinesisAPI := mocks.NewMockKinesisAPI(mockCtrl)
+
+	// 600 records per second are sent as one full and one partial PutRecords call
+	sizes := []int{}
+	mockKinesisAPI.EXPECT().PutRecords(gomock.Any()).Times(2).DoAndReturn(
+		func(input *kinesis.PutRecordsInput) (*kinesis.PutRecordsOutput, error) {
+			assert.Equal(t, "test-stream", aws.StringValue(input.StreamName))
+			sizes = append(sizes, len(input.Records))
+			return &kinesis.PutRecordsOutput{FailedRecordCount: aws.Int64(0)}, nil
+		},
+	)
+
+	assert.NoError(t, generate(testConfig, mockKinesisAPI, rand.New(rand.NewSource(1))))
+	assert.Equal(t, []int{500, 100}, sizes)
+}
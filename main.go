@@ -1,16 +1,22 @@
 package main
 
 import (
+	"encoding/json"
 	"log"
+	"math/rand"
 	"os"
 	"path"
 	"strconv"
+	"strings"
 	"time"
 
 	kbc "github.com/Clever/amazon-kinesis-client-go/batchconsumer"
 	"gopkg.in/Clever/kayvee-go.v6/logger"
 
+	"github.com/Clever/kinesis-to-firehose/loadgen"
+	"github.com/Clever/kinesis-to-firehose/mapping"
 	"github.com/Clever/kinesis-to-firehose/sender"
+	"github.com/Clever/kinesis-to-firehose/sender/stats"
 )
 
 // getEnv looks up an environment variable given and exits if it does not exist.
@@ -32,7 +38,192 @@ func getEnvInt(envVar string) int {
 	return num
 }
 
+// getEnvIntDefault looks up an optional int environment variable, returning def if it is not set.
+func getEnvIntDefault(envVar string, def int) int {
+	if os.Getenv(envVar) == "" {
+		return def
+	}
+	return getEnvInt(envVar)
+}
+
+// getEnvDefault looks up an optional environment variable, returning def if it is not set.
+func getEnvDefault(envVar, def string) string {
+	val := os.Getenv(envVar)
+	if val == "" {
+		return def
+	}
+	return val
+}
+
+// getEnvDuration looks up an optional duration environment variable (e.g. "5m"), returning def
+// if it is not set.
+func getEnvDuration(envVar string, def time.Duration) time.Duration {
+	str := os.Getenv(envVar)
+	if str == "" {
+		return def
+	}
+
+	val, err := time.ParseDuration(str)
+	if err != nil {
+		log.Fatalf("Env variable %s must be a duration instead of '%s'", envVar, str)
+	}
+	return val
+}
+
+// getEnvBool looks up an optional boolean environment variable, returning def if it is not set.
+func getEnvBool(envVar string, def bool) bool {
+	str := os.Getenv(envVar)
+	if str == "" {
+		return def
+	}
+
+	val, err := strconv.ParseBool(str)
+	if err != nil {
+		log.Fatalf("Env variable %s must be a bool instead of '%s'", envVar, str)
+	}
+	return val
+}
+
+// getEnvOneOf looks up an optional environment variable and exits if it isn't one of options.
+// The first option is the default.
+func getEnvOneOf(envVar string, options ...string) string {
+	val := getEnvDefault(envVar, options[0])
+	for _, option := range options {
+		if val == option {
+			return val
+		}
+	}
+
+	log.Fatalf("Env variable %s must be one of %v instead of '%s'", envVar, options, val)
+	return ""
+}
+
+// getEnvList looks up an optional comma-separated environment variable.
+func getEnvList(envVar string) []string {
+	str := os.Getenv(envVar)
+	if str == "" {
+		return nil
+	}
+
+	vals := strings.Split(str, ",")
+	for idx, val := range vals {
+		vals[idx] = strings.TrimSpace(val)
+	}
+	return vals
+}
+
+// getEnvJSON decodes an optional JSON environment variable into v, and exits if it is invalid.
+func getEnvJSON(envVar string, v interface{}) {
+	str := os.Getenv(envVar)
+	if str == "" {
+		return
+	}
+
+	if err := json.Unmarshal([]byte(str), v); err != nil {
+		log.Fatalf("Env variable %s must be valid JSON: %s", envVar, err)
+	}
+}
+
+// jitter randomly lengthens or shortens d by up to percent percent, so that consumers started
+// together don't all flush at the same time.
+func jitter(d time.Duration, percent int) time.Duration {
+	if percent <= 0 {
+		return d
+	}
+	max := int64(d) * int64(percent) / 100
+	return d + time.Duration(rand.Int63n(2*max+1)-max)
+}
+
+// getFirehoseConfig builds the sender's config from environment variables.
+func getFirehoseConfig() sender.FirehoseSenderConfig {
+	firehoseConfig := sender.FirehoseSenderConfig{
+		DeployEnv:      getEnv("_DEPLOY_ENV"),
+		FirehoseRegion: getEnv("FIREHOSE_AWS_REGION"),
+		StreamName:     getEnv("FIREHOSE_STREAM_NAME"),
+		Endpoint:       getEnv("FIREHOSE_AWS_ENDPOINT"),
+		Stages:         getEnvList("SENDER_STAGES"),
+		ContainerOverridePolicy: getEnvOneOf("CONTAINER_OVERRIDE_POLICY",
+			sender.OverrideAllow, sender.OverrideAudit, sender.OverrideDeny),
+		SkipContainerNormalization: !getEnvBool("NORMALIZE_CONTAINER_FIELDS", true),
+		MaxClockSkew:               getEnvDuration("MAX_CLOCK_SKEW", 0),
+		FutureTimestampPolicy: getEnvOneOf("FUTURE_TIMESTAMP_POLICY",
+			sender.FutureTimestampDrop, sender.FutureTimestampClamp),
+		MaxFieldLength:   getEnvIntDefault("MAX_FIELD_LENGTH", 0),
+		BlobMinLength:    getEnvIntDefault("BLOB_MIN_LENGTH", 0),
+		HashedFields:     getEnvList("HASHED_FIELDS"),
+		Base64Fields:     getEnvList("BASE64_FIELDS"),
+		MaxLineLength:    getEnvIntDefault("MAX_LINE_LENGTH", 0),
+		ManifestStream:   os.Getenv("MANIFEST_STREAM_NAME"),
+		FlattenNested:    getEnvBool("FLATTEN_NESTED", false),
+		FlattenSeparator: getEnvDefault("FLATTEN_SEPARATOR", "."),
+		FlattenMaxDepth:  getEnvIntDefault("FLATTEN_MAX_DEPTH", 0),
+		OmitRawFields: getEnvOneOf("OMIT_RAW_FIELDS",
+			sender.OmitRawNone, sender.OmitRawKayvee, sender.OmitRawAll),
+		RecordDelimiter: getEnvOneOf("RECORD_DELIMITER",
+			sender.DelimiterNewline, sender.DelimiterNone, sender.DelimiterRFC7464),
+		ValidateKayvee:   getEnvBool("VALIDATE_KAYVEE", false),
+		QuarantineStream: os.Getenv("QUARANTINE_STREAM_NAME"),
+		HaproxyApps:      getEnvList("HAPROXY_APPS"),
+		BlankLinePolicy: getEnvOneOf("BLANK_LINE_POLICY",
+			sender.BlankLineKeep, sender.BlankLineSkip, sender.BlankLinePlaceholder),
+		NormalizeInteriorCR: getEnvBool("NORMALIZE_INTERIOR_CR", false),
+		KeyValueApps:        getEnvList("KEY_VALUE_APPS"),
+		KeyValuePrefix:      getEnvDefault("KEY_VALUE_PREFIX", "kv_"),
+		ArrayPayloadField:   os.Getenv("ARRAY_PAYLOAD_FIELD"),
+		InstanceMetaRegion:  os.Getenv("INSTANCE_META_REGION"),
+		RequestIDAliases:    getEnvList("REQUEST_ID_ALIASES"),
+		FailureSamples:      getEnvIntDefault("FAILURE_SAMPLES", 0),
+		CompressedStreams:   getEnvList("COMPRESSED_STREAMS"),
+		OversizedRecordPolicy: getEnvOneOf("OVERSIZED_RECORD_POLICY",
+			sender.OversizedDrop, sender.OversizedTruncate),
+		DeadLetterBucket: os.Getenv("DEAD_LETTER_S3_BUCKET"),
+		DeadLetterPrefix: os.Getenv("DEAD_LETTER_S3_PREFIX"),
+	}
+	// An unset MAX_SEND_RETRIES leaves the sender's default, while 0 disables retries, which the
+	// config spells as a negative value
+	if os.Getenv("MAX_SEND_RETRIES") != "" {
+		firehoseConfig.MaxRetries = getEnvInt("MAX_SEND_RETRIES")
+		if firehoseConfig.MaxRetries == 0 {
+			firehoseConfig.MaxRetries = -1
+		}
+	}
+	if len(firehoseConfig.HashedFields) > 0 {
+		firehoseConfig.HashKey = []byte(getEnv("HASH_KEY"))
+	}
+	getEnvJSON("CONTAINER_META_PATTERNS", &firehoseConfig.ContainerMetaPatterns)
+	getEnvJSON("CONTAINER_OVERRIDE_ALLOWLIST", &firehoseConfig.ContainerOverrideAllowlist)
+	getEnvJSON("FIELD_MAX_LENGTHS", &firehoseConfig.FieldMaxLengths)
+	getEnvJSON("BLOB_MIN_LENGTHS", &firehoseConfig.BlobMinLengths)
+	getEnvJSON("METRIC_STREAMS_BY_TYPE", &firehoseConfig.MetricStreamsByType)
+	getEnvJSON("METRIC_STREAMS_BY_TITLE", &firehoseConfig.MetricStreamsByTitle)
+	getEnvJSON("STREAM_DELIMITERS", &firehoseConfig.StreamDelimiters)
+	getEnvJSON("BLANK_LINE_POLICIES", &firehoseConfig.BlankLinePolicies)
+	getEnvJSON("DERIVED_FIELDS", &firehoseConfig.DerivedFields)
+	getEnvJSON("ARRAY_PAYLOAD_FIELDS", &firehoseConfig.ArrayPayloadFields)
+	getEnvJSON("DROP_RULES", &firehoseConfig.DropRules)
+
+	return firehoseConfig
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "loadgen":
+			err = loadgen.Run(os.Args[2:])
+		case "mapping-report":
+			err = mapping.Run(os.Args[2:], getFirehoseConfig())
+		case "describe-resources":
+			err = describeResources(os.Stdout, getFirehoseConfig())
+		default:
+			log.Fatalf("Unknown subcommand %s", os.Args[1])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	exePath, err := os.Executable()
 	if err != nil {
 		log.Fatal(err)
@@ -43,23 +234,25 @@ func main() {
 		log.Fatal(err)
 	}
 
+	stats.MonitorResources(time.Minute,
+		getEnvIntDefault("MAX_GOROUTINES", 0), getEnvIntDefault("MAX_OPEN_FDS", 0))
+
+	rand.Seed(time.Now().UnixNano())
 	suffix := "." + time.Now().Format("2006-01-02T15:04:05") + ".log"
+	// At 100 percent or more, the flush interval could be jittered down to nothing
+	jitterPercent := getEnvIntDefault("FLUSH_JITTER_PERCENT", 0)
+	if jitterPercent < 0 || jitterPercent >= 100 {
+		log.Fatalf("Env variable FLUSH_JITTER_PERCENT must be from 0 to 99 instead of '%d'", jitterPercent)
+	}
 	kbcConfig := kbc.Config{
-		BatchInterval:  10 * time.Second,
+		BatchInterval:  jitter(10*time.Second, jitterPercent),
 		BatchCount:     500,
 		BatchSize:      4 * 1024 * 1024, // 4Mb
 		FailedLogsFile: getEnv("LOG_FILE") + suffix,
 		ReadRateLimit:  getEnvInt("READ_RATE_LIMIT"),
 	}
 
-	firehoseConfig := sender.FirehoseSenderConfig{
-		DeployEnv:      getEnv("_DEPLOY_ENV"),
-		FirehoseRegion: getEnv("FIREHOSE_AWS_REGION"),
-		StreamName:     getEnv("FIREHOSE_STREAM_NAME"),
-		Endpoint:       getEnv("FIREHOSE_AWS_ENDPOINT"),
-	}
-
-	sender := sender.NewFirehoseSender(firehoseConfig)
+	sender := sender.NewFirehoseSender(getFirehoseConfig())
 	consumer := kbc.NewBatchConsumer(kbcConfig, sender)
 	consumer.Start()
 }
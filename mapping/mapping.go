@@ -0,0 +1,221 @@
+// Package mapping runs a corpus of log lines through the sender and reports the Elasticsearch
+// field mapping its output implies, so mapping conflicts can be caught before shipping changes.
+package mapping
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Clever/kinesis-to-firehose/sender"
+)
+
+// maxLineSize is the longest corpus line that can be read
+const maxLineSize = 1024 * 1024
+
+// Report maps each field's dotted path to the number of times each inferred type was seen
+type Report map[string]map[string]int
+
+// Run parses args (the arguments after the "mapping-report" subcommand), runs the corpus through
+// a sender built from config, and prints conflicts and differences from a previous report
+func Run(args []string, config sender.FirehoseSenderConfig) error {
+	flags := flag.NewFlagSet("mapping-report", flag.ContinueOnError)
+	input := flags.String("input", "", "file of raw log lines (default stdin)")
+	output := flags.String("output", "", "file to write this run's report to")
+	previous := flags.String("previous", "", "report from a previous run to diff against")
+	deployEnv := flags.String("env", config.DeployEnv, "deploy env passed to decode")
+	stages := flags.String("stages", "", "comma-separated sender stages (default: SENDER_STAGES)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	config.DeployEnv = *deployEnv
+	if *stages != "" {
+		config.Stages = strings.Split(*stages, ",")
+	}
+	report, failed, err := Build(sender.NewFirehoseSender(config), in)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d fields, %d lines failed to decode\n", len(report), failed)
+
+	for _, line := range Conflicts(report) {
+		fmt.Println(line)
+	}
+
+	if *previous != "" {
+		data, err := ioutil.ReadFile(*previous)
+		if err != nil {
+			return err
+		}
+		prev := Report{}
+		if err := json.Unmarshal(data, &prev); err != nil {
+			return fmt.Errorf("invalid previous report: %s", err)
+		}
+		for _, line := range Diff(prev, report) {
+			fmt.Println(line)
+		}
+	}
+
+	if *output != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(*output, data, 0644)
+	}
+	return nil
+}
+
+// Build runs each line in r through the sender and tallies the types of the fields it outputs.
+// Lines that the sender fails or drops are counted, but don't contribute to the report. The
+// fields are taken from Decode rather than ProcessMessage, so record delimiters, compression, and
+// truncation of oversized records don't affect the report.
+func Build(s *sender.FirehoseSender, r io.Reader) (Report, int, error) {
+	report := Report{}
+	failed := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		decoded, _, err := s.Decode(scanner.Bytes())
+		if err != nil {
+			failed++
+			continue
+		}
+
+		// Round-trip through JSON so values have the types Elasticsearch sees
+		msg, err := json.Marshal(decoded)
+		if err != nil {
+			return nil, failed, err
+		}
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(msg, &fields); err != nil {
+			return nil, failed, err
+		}
+		report.add("", fields)
+	}
+
+	return report, failed, scanner.Err()
+}
+
+// add tallies the types of fields, with nested objects flattened into dotted paths
+func (r Report) add(prefix string, fields map[string]interface{}) {
+	for key, val := range fields {
+		path := prefix + key
+		if nested, ok := val.(map[string]interface{}); ok {
+			r.add(path+".", nested)
+			continue
+		}
+
+		esType := inferType(val)
+		if esType == "" {
+			continue
+		}
+		if r[path] == nil {
+			r[path] = map[string]int{}
+		}
+		r[path][esType]++
+	}
+}
+
+// inferType returns the type Elasticsearch's dynamic mapping would pick for a JSON value, or ""
+// for values that don't create a mapping (nulls and empty arrays)
+func inferType(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		if _, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return "date"
+		}
+		return "text"
+	case float64:
+		if v == math.Trunc(v) {
+			return "long"
+		}
+		return "float"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		if len(v) == 0 {
+			return ""
+		}
+		return inferType(v[0])
+	case map[string]interface{}:
+		return "object"
+	}
+	return ""
+}
+
+// types returns the sorted type names in counts
+func types(counts map[string]int) []string {
+	names := []string{}
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedFields returns the sorted field paths in a report
+func sortedFields(r Report) []string {
+	fields := []string{}
+	for field := range r {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Conflicts describes the fields that were seen with more than one type
+func Conflicts(r Report) []string {
+	lines := []string{}
+	for _, field := range sortedFields(r) {
+		if len(r[field]) > 1 {
+			counts := []string{}
+			for _, name := range types(r[field]) {
+				counts = append(counts, fmt.Sprintf("%s=%d", name, r[field][name]))
+			}
+			lines = append(lines,
+				fmt.Sprintf("! %s has conflicting types: %s", field, strings.Join(counts, ", ")))
+		}
+	}
+	return lines
+}
+
+// Diff describes the fields that were added, removed, or changed type between two reports
+func Diff(prev, cur Report) []string {
+	lines := []string{}
+	for _, field := range sortedFields(cur) {
+		curTypes := strings.Join(types(cur[field]), ",")
+		prevCounts, ok := prev[field]
+		if !ok {
+			lines = append(lines, fmt.Sprintf("+ %s (%s)", field, curTypes))
+		} else if prevTypes := strings.Join(types(prevCounts), ","); prevTypes != curTypes {
+			lines = append(lines, fmt.Sprintf("~ %s (%s -> %s)", field, prevTypes, curTypes))
+		}
+	}
+	for _, field := range sortedFields(prev) {
+		if _, ok := cur[field]; !ok {
+			lines = append(lines, fmt.Sprintf("- %s (%s)", field, strings.Join(types(prev[field]), ",")))
+		}
+	}
+	return lines
+}
@@ -0,0 +1,64 @@
+package mapping
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Clever/kinesis-to-firehose/sender"
+)
+
+const corpus = `2017-08-16T04:37:52.901092+00:00 ip-10-0-102-159 production--my-app/` +
+	`arn%3Aaws%3Aecs%3Aus-west-1%3A589690932525%3Atask%2F124cc8a5-0549-4149-922b-cd411b813d11` +
+	`[3252]: {"title":"a","count":1,"ratio":0.5,"nested":{"ok":true}}
+2017-08-16T04:37:53.901092+00:00 ip-10-0-102-159 production--my-app/` +
+	`arn%3Aaws%3Aecs%3Aus-west-1%3A589690932525%3Atask%2F124cc8a5-0549-4149-922b-cd411b813d11` +
+	`[3252]: {"title":"b","count":"many"}
+not a syslog line
+`
+
+func TestBuild(t *testing.T) {
+	s := sender.NewFirehoseSender(sender.FirehoseSenderConfig{DeployEnv: "test"})
+	report, failed, err := Build(s, strings.NewReader(corpus))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failed)
+
+	assert.Equal(t, map[string]int{"text": 2}, report["title"])
+	assert.Equal(t, map[string]int{"long": 1, "text": 1}, report["count"])
+	assert.Equal(t, map[string]int{"float": 1}, report["ratio"])
+	assert.Equal(t, map[string]int{"boolean": 1}, report["nested.ok"])
+	assert.Equal(t, map[string]int{"date": 2}, report["timestamp"])
+
+	assert.Equal(t, []string{"! count has conflicting types: long=1, text=1"}, Conflicts(report))
+}
+
+func TestBuildIgnoresRecordDelimiter(t *testing.T) {
+	s := sender.NewFirehoseSender(sender.FirehoseSenderConfig{
+		DeployEnv:       "test",
+		RecordDelimiter: sender.DelimiterRFC7464,
+	})
+	report, failed, err := Build(s, strings.NewReader(corpus))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, map[string]int{"text": 2}, report["title"])
+}
+
+func TestDiff(t *testing.T) {
+	prev := Report{
+		"title":   {"text": 5},
+		"count":   {"long": 5},
+		"removed": {"boolean": 1},
+	}
+	cur := Report{
+		"title": {"text": 3},
+		"count": {"long": 2, "text": 1},
+		"added": {"float": 1},
+	}
+
+	assert.Equal(t, []string{
+		"+ added (float)",
+		"~ count (long -> long,text)",
+		"- removed (boolean)",
+	}, Diff(prev, cur))
+}
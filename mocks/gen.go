@@ -1,3 +1,6 @@
 package mocks
 
 //go:generate sh -c "$PWD/bin/mockgen -package mocks -source $PWD/vendor/github.com/aws/aws-sdk-go/service/firehose/firehoseiface/interface.go FirehoseAPI > mockfirehose.go"
+//go:generate sh -c "$PWD/bin/mockgen -package mocks -source $PWD/vendor/github.com/aws/aws-sdk-go/service/kinesis/kinesisiface/interface.go KinesisAPI > mockkinesis.go"
+//go:generate sh -c "$PWD/bin/mockgen -package mocks -source $PWD/vendor/github.com/aws/aws-sdk-go/service/ec2/ec2iface/interface.go EC2API > mockec2.go"
+//go:generate sh -c "$PWD/bin/mockgen -package mocks -source $PWD/vendor/github.com/aws/aws-sdk-go/service/s3/s3iface/interface.go S3API > mocks3.go"
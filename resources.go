@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/Clever/kinesis-to-firehose/sender"
+)
+
+// awsResource is an AWS resource the consumer uses, and the IAM actions it needs on it
+type awsResource struct {
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	ARN     string   `json:"arn"`
+	Actions []string `json:"actions"`
+}
+
+// describeResources writes the AWS resources and IAM actions needed to run the consumer with the
+// given config as JSON, so infrastructure can be provisioned from it
+func describeResources(w io.Writer, config sender.FirehoseSenderConfig) error {
+	kinesisRegion := getEnv("KINESIS_AWS_REGION")
+	kinesisStream := getEnv("KINESIS_STREAM_NAME")
+	appName := getEnv("KINESIS_APPLICATION_NAME")
+
+	resources := []awsResource{
+		{
+			Type: "AWS::Kinesis::Stream",
+			Name: kinesisStream,
+			ARN:  fmt.Sprintf("arn:aws:kinesis:%s:*:stream/%s", kinesisRegion, kinesisStream),
+			Actions: []string{
+				"kinesis:DescribeStream",
+				"kinesis:GetRecords",
+				"kinesis:GetShardIterator",
+				"kinesis:ListShards",
+			},
+		},
+		{
+			// The KCL keeps its leases and checkpoints in a table named after the application
+			Type: "AWS::DynamoDB::Table",
+			Name: appName,
+			ARN:  fmt.Sprintf("arn:aws:dynamodb:%s:*:table/%s", kinesisRegion, appName),
+			Actions: []string{
+				"dynamodb:CreateTable",
+				"dynamodb:DeleteItem",
+				"dynamodb:DescribeTable",
+				"dynamodb:GetItem",
+				"dynamodb:PutItem",
+				"dynamodb:Scan",
+				"dynamodb:UpdateItem",
+			},
+		},
+		{
+			// The KCL publishes its own metrics to CloudWatch
+			Type:    "AWS::CloudWatch::Metrics",
+			Name:    appName,
+			ARN:     "*",
+			Actions: []string{"cloudwatch:PutMetricData"},
+		},
+	}
+
+	if config.InstanceMetaRegion != "" {
+		resources = append(resources, awsResource{
+			// DescribeInstances can't be limited to specific instances
+			Type:    "AWS::EC2::Instance",
+			Name:    config.InstanceMetaRegion,
+			ARN:     "*",
+			Actions: []string{"ec2:DescribeInstances"},
+		})
+	}
+
+	if config.DeadLetterBucket != "" {
+		resources = append(resources, awsResource{
+			Type:    "AWS::S3::Bucket",
+			Name:    config.DeadLetterBucket,
+			ARN:     fmt.Sprintf("arn:aws:s3:::%s/%s*", config.DeadLetterBucket, config.DeadLetterPrefix),
+			Actions: []string{"s3:PutObject"},
+		})
+	}
+
+	streams := []string{}
+	for _, stream := range config.MetricStreamsByType {
+		streams = append(streams, stream)
+	}
+	for _, stream := range config.MetricStreamsByTitle {
+		streams = append(streams, stream)
+	}
+	if config.ManifestStream != "" {
+		streams = append(streams, config.ManifestStream)
+	}
+	if config.QuarantineStream != "" {
+		streams = append(streams, config.QuarantineStream)
+	}
+	sort.Strings(streams)
+	streams = append([]string{config.StreamName}, streams...)
+
+	seen := map[string]bool{}
+	for _, stream := range streams {
+		if seen[stream] {
+			continue
+		}
+		seen[stream] = true
+		resources = append(resources, awsResource{
+			Type:    "AWS::KinesisFirehose::DeliveryStream",
+			Name:    stream,
+			ARN:     fmt.Sprintf("arn:aws:firehose:%s:*:deliverystream/%s", config.FirehoseRegion, stream),
+			Actions: []string{"firehose:PutRecordBatch"},
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string]interface{}{"resources": resources})
+}
@@ -0,0 +1,38 @@
+package sender
+
+import (
+	"regexp"
+)
+
+// accessLog matches the common and combined access log formats written by nginx and Apache, e.g.
+// `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326
+// "http://www.example.com/start.html" "Mozilla/4.08"`
+var accessLog = regexp.MustCompile(`^(?P<remote_addr>\S+) \S+ (?P<remote_user>\S+) ` +
+	`\[(?P<time_local>[^\]]+)\] ` +
+	`"(?:(?P<request_method>[A-Z]+) (?P<request>\S+)(?: (?P<http_version>HTTP/[0-9.]+))?|[^"]*)" ` +
+	`(?P<http_status>\d{3}) (?P<body_bytes_sent>\d+|-)` +
+	`(?: "(?P<http_referer>[^"]*)" "(?P<http_user_agent>[^"]*)")?`)
+
+// accessLogIntFields are the access log fields which are numbers
+var accessLogIntFields = map[string]bool{
+	"http_status":     true,
+	"body_bytes_sent": true,
+}
+
+// parseAccessLog parses the raw log of non-Kayvee logs in common or combined access log format
+// into fields
+func parseAccessLog(fields map[string]interface{}) {
+	if isKayvee(fields) {
+		return
+	}
+	rawlog, ok := fields["rawlog"].(string)
+	if !ok {
+		return
+	}
+
+	matches := namedMatches(accessLog, rawlog)
+	if matches == nil {
+		return
+	}
+	setParsedFields(fields, matches, accessLogIntFields)
+}
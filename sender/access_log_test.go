@@ -0,0 +1,45 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeAccessLog(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	fields, _, err := sender.Decode([]byte(myAppPrefix + `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] ` +
+		`"GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" ` +
+		`"Mozilla/4.08 [en] (Win98; I ;Nav)"`))
+	assert.NoError(t, err)
+	for field, val := range map[string]interface{}{
+		"remote_addr":     "127.0.0.1",
+		"remote_user":     "frank",
+		"time_local":      "10/Oct/2000:13:55:36 -0700",
+		"request_method":  "GET",
+		"request":         "/apache_pb.gif",
+		"http_version":    "HTTP/1.0",
+		"http_status":     200,
+		"body_bytes_sent": 2326,
+		"http_referer":    "http://www.example.com/start.html",
+		"http_user_agent": "Mozilla/4.08 [en] (Win98; I ;Nav)",
+	} {
+		assert.Equal(t, val, fields[field], field)
+	}
+
+	// Common log format, with unset fields
+	fields, _, err = sender.Decode([]byte(myAppPrefix + `10.0.0.1 - - [10/Oct/2000:13:55:36 +0000] "-" 400 -`))
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", fields["remote_addr"])
+	assert.Equal(t, 400, fields["http_status"])
+	assert.NotContains(t, fields, "remote_user")
+	assert.NotContains(t, fields, "body_bytes_sent")
+	assert.NotContains(t, fields, "request_method")
+
+	// Kayvee logs aren't parsed, even when their prefix looks like an access log
+	fields, _, err = sender.Decode([]byte(myAppPrefix + `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] ` +
+		`"GET /apache_pb.gif HTTP/1.0" 200 2326 {"title":"request-finished"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "request-finished", fields["title"])
+	assert.NotContains(t, fields, "remote_addr")
+}
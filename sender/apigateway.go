@@ -0,0 +1,52 @@
+package sender
+
+import (
+	"regexp"
+)
+
+// apiGatewayExecutionLog matches an API Gateway execution log line, which starts with the
+// request ID, e.g. `(c2f3a0e7-4b1e-11e9-8f3e-1b2c3d4e5f6a) Method completed with status: 200`
+var apiGatewayExecutionLog = regexp.MustCompile(`^\((?P<apigw_request_id>[0-9a-f]{8}-[0-9a-f]{4}-` +
+	`[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})\) (?P<message>.*)$`)
+
+// apiGatewayMessages match the execution log messages that carry request details
+var apiGatewayMessages = []*regexp.Regexp{
+	regexp.MustCompile(`^HTTP Method: (?P<apigw_http_method>[A-Z]+), ` +
+		`Resource Path: (?P<apigw_resource_path>\S+)`),
+	regexp.MustCompile(`^Method completed with status: (?P<http_status>\d+)`),
+	regexp.MustCompile(`^Received response\. Status: (?P<apigw_integration_status>\d+), ` +
+		`Integration latency: (?P<apigw_integration_latency_ms>\d+) ms`),
+}
+
+// apiGatewayIntFields are the API Gateway fields which are numbers
+var apiGatewayIntFields = map[string]bool{
+	"http_status":                  true,
+	"apigw_integration_status":     true,
+	"apigw_integration_latency_ms": true,
+}
+
+// parseAPIGateway parses the raw log of non-Kayvee API Gateway execution logs into fields.
+// Every line gets apigw_request_id; lines with the method, resource path, status, or integration
+// latency get those too.
+func parseAPIGateway(fields map[string]interface{}) {
+	if isKayvee(fields) {
+		return
+	}
+	rawlog, ok := fields["rawlog"].(string)
+	if !ok {
+		return
+	}
+
+	matches := namedMatches(apiGatewayExecutionLog, rawlog)
+	if matches == nil {
+		return
+	}
+	setDefault(fields, "apigw_request_id", matches["apigw_request_id"])
+
+	for _, re := range apiGatewayMessages {
+		if details := namedMatches(re, matches["message"]); details != nil {
+			setParsedFields(fields, details, apiGatewayIntFields)
+			return
+		}
+	}
+}
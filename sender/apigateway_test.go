@@ -0,0 +1,58 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAPIGateway(t *testing.T) {
+	requestID := "c2f3a0e7-4b1e-11e9-8f3e-1b2c3d4e5f6a"
+	tests := []struct {
+		rawlog   string
+		expected map[string]interface{}
+	}{
+		{
+			rawlog: "(" + requestID + ") HTTP Method: GET, Resource Path: /pets/1",
+			expected: map[string]interface{}{
+				"apigw_http_method":   "GET",
+				"apigw_resource_path": "/pets/1",
+			},
+		},
+		{
+			rawlog: "(" + requestID + ") Received response. Status: 502, Integration latency: 25 ms",
+			expected: map[string]interface{}{
+				"apigw_integration_status":     502,
+				"apigw_integration_latency_ms": 25,
+			},
+		},
+		{
+			rawlog:   "(" + requestID + ") Method completed with status: 200",
+			expected: map[string]interface{}{"http_status": 200},
+		},
+		{
+			rawlog:   "(" + requestID + ") Starting execution for request: " + requestID,
+			expected: map[string]interface{}{},
+		},
+	}
+
+	for _, test := range tests {
+		fields := map[string]interface{}{"rawlog": test.rawlog}
+		parseAPIGateway(fields)
+
+		test.expected["rawlog"] = test.rawlog
+		test.expected["apigw_request_id"] = requestID
+		assert.Equal(t, test.expected, fields)
+	}
+
+	fields := map[string]interface{}{"rawlog": "(not-a-request-id) Method completed with status: 200"}
+	parseAPIGateway(fields)
+	assert.Len(t, fields, 1)
+
+	// Kayvee logs aren't parsed
+	fields, _, err := setupFirehoseSender(t).Decode([]byte(myAppPrefix +
+		"(" + requestID + `) {"title":"request"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "request", fields["title"])
+	assert.NotContains(t, fields, "apigw_request_id")
+}
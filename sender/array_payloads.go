@@ -0,0 +1,97 @@
+package sender
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// wrapArrayPayload parses a log whose payload is a JSON array, which decode can't handle, and
+// puts the array under the sender's array payload field for the log's app
+func (f *FirehoseSender) wrapArrayPayload(fields map[string]interface{}) {
+	field := f.arrayPayloadField
+	if app, ok := fields["container_app"].(string); ok {
+		if appField, ok := f.arrayPayloadFields[app]; ok {
+			field = appField
+		}
+	}
+	if field == "" {
+		return
+	}
+	kayvee := isKayvee(fields)
+	if kayvee && !isWrappedInArray(fields) {
+		return
+	}
+
+	rawlog, ok := fields["rawlog"].(string)
+	if !ok {
+		return
+	}
+	firstIdx := strings.Index(rawlog, "[")
+	lastIdx := strings.LastIndex(rawlog, "]")
+	if firstIdx == -1 || lastIdx < firstIdx {
+		return
+	}
+
+	payload := []interface{}{}
+	if err := json.Unmarshal([]byte(rawlog[firstIdx:lastIdx+1]), &payload); err != nil {
+		return
+	}
+
+	if kayvee {
+		f.unmergeKayvee(fields, rawlog[firstIdx:lastIdx+1])
+	}
+	setDefault(fields, field, payload)
+}
+
+// decodeOwnedFields are set by decode itself, so the values a Kayvee payload has for them are
+// never merged into a log's fields
+var decodeOwnedFields = map[string]bool{
+	"prefix":           true,
+	"postfix":          true,
+	"decoder_msg_type": true,
+	"timestamp":        true,
+	"hostname":         true,
+	"rawlog":           true,
+	"env":              true,
+}
+
+// unmergeKayvee undoes decode's merge of a one-object array's object into fields. Only fields
+// that still hold the object's value are removed, so the syslog fields and anything the object
+// didn't override are kept. container_* fields that the object did override are filled back in
+// from the programname.
+func (f *FirehoseSender) unmergeKayvee(fields map[string]interface{}, array string) {
+	objects := []map[string]interface{}{}
+	decoder := json.NewDecoder(strings.NewReader(array))
+	decoder.UseNumber()
+	if err := decoder.Decode(&objects); err != nil || len(objects) != 1 {
+		return
+	}
+
+	for key, val := range objects[0] {
+		if decodeOwnedFields[key] || !sameJSON(fields[key], val) {
+			continue
+		}
+		delete(fields, key)
+	}
+	delete(fields, "prefix")
+	delete(fields, "postfix")
+	delete(fields, "decoder_msg_type")
+	f.addContainerMeta(fields)
+}
+
+// sameJSON reports whether two values marshal to the same JSON, so e.g. a float64 and a
+// json.Number holding the same integer are equal
+func sameJSON(a, b interface{}) bool {
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && string(aJSON) == string(bJSON)
+}
+
+// isWrappedInArray reports whether a Kayvee log's payload is really a one-object JSON array,
+// which decode parses as the object with "[" and "]" around it
+func isWrappedInArray(fields map[string]interface{}) bool {
+	prefix, _ := fields["prefix"].(string)
+	postfix, _ := fields["postfix"].(string)
+	return strings.HasSuffix(strings.TrimSpace(prefix), "[") &&
+		strings.HasPrefix(strings.TrimSpace(postfix), "]")
+}
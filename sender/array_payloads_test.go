@@ -0,0 +1,61 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapArrayPayload(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	line := myAppPrefix + `batch: [{"title":"a"},{"title":"b"}]`
+
+	fields, _, err := sender.Decode([]byte(line))
+	assert.NoError(t, err)
+	assert.NotContains(t, fields, "items")
+
+	sender.arrayPayloadField = "items"
+	fields, _, err = sender.Decode([]byte(line))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"title": "a"},
+		map[string]interface{}{"title": "b"},
+	}, fields["items"])
+	assert.Equal(t, `batch: [{"title":"a"},{"title":"b"}]`, fields["rawlog"])
+
+	sender.arrayPayloadFields = map[string]string{"my-app": ""}
+	fields, _, err = sender.Decode([]byte(line))
+	assert.NoError(t, err)
+	assert.NotContains(t, fields, "items")
+}
+
+func TestWrapArrayPayloadSingleObject(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	sender.arrayPayloadField = "items"
+
+	// decode parses a one-object array as that object, with the brackets around it
+	fields, _, err := sender.Decode([]byte(myAppPrefix +
+		`[{"title":"a","count":1,"hostname":"elsewhere","container_app":"other-app"}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"title": "a", "count": float64(1), "hostname": "elsewhere", "container_app": "other-app",
+		},
+	}, fields["items"])
+	assert.NotContains(t, fields, "title")
+	assert.NotContains(t, fields, "count")
+	assert.NotContains(t, fields, "prefix")
+	assert.NotContains(t, fields, "decoder_msg_type")
+
+	// Fields the object didn't set are kept, or filled back in from the programname
+	assert.Equal(t, "ip-10-0-102-159", fields["hostname"])
+	assert.Contains(t, fields, "timestamp")
+	assert.Equal(t, "production", fields["container_env"])
+	assert.Equal(t, "my-app", fields["container_app"])
+
+	// Kayvee logs that aren't arrays are left alone
+	fields, _, err = sender.Decode([]byte(myAppPrefix + `[info] {"title":"a"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "a", fields["title"])
+	assert.NotContains(t, fields, "items")
+}
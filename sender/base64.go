@@ -0,0 +1,54 @@
+package sender
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/Clever/kinesis-to-firehose/sender/stats"
+)
+
+// base64Encodings are tried in order when decoding base64 fields
+var base64Encodings = []*base64.Encoding{
+	base64.StdEncoding,
+	base64.URLEncoding,
+	base64.RawStdEncoding,
+	base64.RawURLEncoding,
+}
+
+// decodeBase64JSON decodes a base64-encoded JSON value
+func decodeBase64JSON(s string) (interface{}, bool) {
+	for _, encoding := range base64Encodings {
+		data, err := encoding.DecodeString(s)
+		if err != nil {
+			continue
+		}
+
+		var val interface{}
+		if err := json.Unmarshal(data, &val); err != nil {
+			return nil, false
+		}
+		return val, true
+	}
+	return nil, false
+}
+
+// decodeBase64Fields replaces the configured fields' base64-encoded JSON with the structured
+// value it encodes. Fields that can't be decoded are left alone.
+func (f *FirehoseSender) decodeBase64Fields(fields map[string]interface{}) {
+	for _, path := range f.base64Fields {
+		parent, key, ok := lookupField(fields, path)
+		if !ok {
+			continue
+		}
+		encoded, ok := parent[key].(string)
+		if !ok {
+			continue
+		}
+
+		if val, ok := decodeBase64JSON(encoded); ok {
+			parent[key] = val
+		} else {
+			stats.Counter("base64-field-decode-failures", 1)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package sender
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeBase64Fields(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	sender.base64Fields = []string{"body", "sqs.body", "not_json", "missing"}
+
+	body := `{"event":"signup","user":{"id":"abc"}}`
+	fields := map[string]interface{}{
+		"body":     base64.StdEncoding.EncodeToString([]byte(body)),
+		"sqs":      map[string]interface{}{"body": base64.RawURLEncoding.EncodeToString([]byte(body))},
+		"not_json": base64.StdEncoding.EncodeToString([]byte("plain text")),
+	}
+	sender.decodeBase64Fields(fields)
+
+	expected := map[string]interface{}{
+		"event": "signup",
+		"user":  map[string]interface{}{"id": "abc"},
+	}
+	assert.Equal(t, expected, fields["body"])
+	assert.Equal(t, expected, fields["sqs"].(map[string]interface{})["body"])
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("plain text")), fields["not_json"])
+}
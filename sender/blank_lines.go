@@ -0,0 +1,74 @@
+package sender
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	kbc "github.com/Clever/amazon-kinesis-client-go/batchconsumer"
+
+	"github.com/Clever/kinesis-to-firehose/sender/stats"
+)
+
+// Policies for logs whose message is empty or only whitespace
+const (
+	// BlankLineKeep sends the log as-is. Entirely blank lines fail to decode.
+	BlankLineKeep = "keep"
+	// BlankLineSkip drops the log, and counts it in the blank-lines-skipped counter
+	BlankLineSkip = "skip"
+	// BlankLinePlaceholder sends a minimal record marked with blank_line=true
+	BlankLinePlaceholder = "placeholder"
+)
+
+// validateBlankLinePolicy returns an error if policy isn't one of the blank-line policies
+func validateBlankLinePolicy(policy string) error {
+	switch policy {
+	case "", BlankLineKeep, BlankLineSkip, BlankLinePlaceholder:
+		return nil
+	}
+	return fmt.Errorf("unknown blank line policy '%s'", policy)
+}
+
+// isBlank returns true if s is empty or only whitespace
+func isBlank(s string) bool {
+	return strings.TrimSpace(s) == ""
+}
+
+// getBlankLinePolicy returns the blank-line policy for an app
+func (f *FirehoseSender) getBlankLinePolicy(app string) string {
+	if policy, ok := f.blankLinePolicies[app]; ok {
+		return policy
+	}
+	if f.blankLinePolicy == "" {
+		return BlankLineKeep
+	}
+	return f.blankLinePolicy
+}
+
+// blankLine returns the placeholder fields for an entirely blank line, which decode can't parse
+func (f *FirehoseSender) blankLine() map[string]interface{} {
+	return map[string]interface{}{
+		"timestamp":  time.Now(),
+		"env":        f.deployEnv,
+		"rawlog":     "",
+		"blank_line": true,
+	}
+}
+
+// checkBlankLine applies the blank-line policy for a log's app if its message is blank. It
+// returns kbc.ErrMessageIgnored if the log should be dropped.
+func (f *FirehoseSender) checkBlankLine(fields map[string]interface{}) error {
+	if rawlog, ok := fields["rawlog"].(string); !ok || !isBlank(rawlog) {
+		return nil
+	}
+
+	app, _ := fields["container_app"].(string)
+	switch f.getBlankLinePolicy(app) {
+	case BlankLineSkip:
+		stats.Counter("blank-lines-skipped", 1)
+		return kbc.ErrMessageIgnored
+	case BlankLinePlaceholder:
+		fields["blank_line"] = true
+	}
+	return nil
+}
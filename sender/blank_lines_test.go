@@ -0,0 +1,56 @@
+package sender
+
+import (
+	"errors"
+	"testing"
+
+	kbc "github.com/Clever/amazon-kinesis-client-go/batchconsumer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessMessageBlankMessages(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	line := myAppPrefix + " \t"
+
+	out := decodeOutput(t, sender, line)
+	assert.NotContains(t, out, "blank_line")
+
+	sender.blankLinePolicy = BlankLineSkip
+	_, _, err := sender.ProcessMessage([]byte(line))
+	assert.Equal(t, kbc.ErrMessageIgnored, err)
+	out = decodeOutput(t, sender, myAppPrefix+"not blank")
+	assert.Equal(t, "not blank", out["rawlog"])
+
+	// Per-app policies take precedence
+	sender.blankLinePolicies = map[string]string{"my-app": BlankLinePlaceholder}
+	out = decodeOutput(t, sender, line)
+	assert.Equal(t, true, out["blank_line"])
+	assert.Equal(t, "my-app", out["container_app"])
+}
+
+func TestProcessMessageBlankLines(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	_, _, err := sender.ProcessMessage([]byte("  \r\n"))
+	assert.True(t, errors.Is(err, ErrNotSyslog))
+
+	sender.blankLinePolicy = BlankLineSkip
+	_, _, err = sender.ProcessMessage([]byte("  \r\n"))
+	assert.Equal(t, kbc.ErrMessageIgnored, err)
+
+	// Policies for entirely blank lines apply even if the blank-lines stage isn't run
+	sender.stages, err = getStages([]string{"container-meta"})
+	assert.NoError(t, err)
+	_, _, err = sender.ProcessMessage([]byte("  \r\n"))
+	assert.Equal(t, kbc.ErrMessageIgnored, err)
+
+	sender.blankLinePolicy = BlankLinePlaceholder
+	out := decodeOutput(t, sender, "")
+	assert.Equal(t, true, out["blank_line"])
+	assert.Contains(t, out, "timestamp")
+}
+
+func TestValidateBlankLinePolicy(t *testing.T) {
+	assert.NoError(t, validateBlankLinePolicy(""))
+	assert.NoError(t, validateBlankLinePolicy(BlankLineSkip))
+	assert.EqualError(t, validateBlankLinePolicy("drop"), "unknown blank line policy 'drop'")
+}
@@ -0,0 +1,119 @@
+package sender
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Clever/kinesis-to-firehose/sender/stats"
+)
+
+// defaultBlobMinEntropy is the entropy, in bits per character, above which a run of base64
+// characters is treated as an encoded blob. Random base64 is close to 6; text and identifiers
+// are usually well under 5.
+const defaultBlobMinEntropy = 5.0
+
+// isBase64Char reports whether c can appear in standard or URL-safe base64
+func isBase64Char(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+		c == '+' || c == '/' || c == '=' || c == '-' || c == '_'
+}
+
+// entropy returns the Shannon entropy of s in bits per byte
+func entropy(s string) float64 {
+	counts := [256]int{}
+	for idx := 0; idx < len(s); idx++ {
+		counts[s[idx]]++
+	}
+
+	total := float64(len(s))
+	bits := 0.0
+	for _, count := range counts {
+		if count > 0 {
+			p := float64(count) / total
+			bits -= p * math.Log2(p)
+		}
+	}
+	return bits
+}
+
+// replaceBlobs replaces runs of at least minLength base64 characters whose entropy is at least
+// minEntropy with a placeholder. It returns the new string, and the number and total size of the
+// blobs it replaced.
+func replaceBlobs(s string, minLength int, minEntropy float64) (string, int, int) {
+	var out strings.Builder
+	blobs, blobBytes := 0, 0
+	start := 0
+	for idx := 0; idx <= len(s); idx++ {
+		if idx < len(s) && isBase64Char(s[idx]) {
+			continue
+		}
+
+		run := s[start:idx]
+		if len(run) >= minLength {
+			if e := entropy(run); e >= minEntropy {
+				fmt.Fprintf(&out, "[blob: %d bytes, entropy %.2f]", len(run), e)
+				blobs++
+				blobBytes += len(run)
+				run = ""
+			}
+		}
+		out.WriteString(run)
+		if idx < len(s) {
+			out.WriteByte(s[idx])
+		}
+		start = idx + 1
+	}
+
+	if blobs == 0 {
+		return s, 0, 0
+	}
+	return out.String(), blobs, blobBytes
+}
+
+// replaceBlobFields replaces encoded blobs in every string value, including in nested objects,
+// and records how many were removed in blobs_removed and blob_bytes_removed
+func (f *FirehoseSender) replaceBlobFields(fields map[string]interface{}) {
+	minLength := f.blobMinLength
+	if app, ok := fields["container_app"].(string); ok {
+		if appMin, ok := f.blobMinLengths[app]; ok {
+			minLength = appMin
+		}
+	}
+	if minLength <= 0 {
+		return
+	}
+
+	minEntropy := f.blobMinEntropy
+	if minEntropy <= 0 {
+		minEntropy = defaultBlobMinEntropy
+	}
+
+	blobs, blobBytes := replaceBlobValues(fields, minLength, minEntropy)
+	if blobs > 0 {
+		fields["blobs_removed"] = blobs
+		fields["blob_bytes_removed"] = blobBytes
+		stats.Counter("blobs-removed", blobs)
+	}
+}
+
+// replaceBlobValues applies replaceBlobs to the string values in fields, recursively
+func replaceBlobValues(fields map[string]interface{}, minLength int, minEntropy float64) (int, int) {
+	blobs, blobBytes := 0, 0
+	for key, val := range fields {
+		switch v := val.(type) {
+		case map[string]interface{}:
+			nestedBlobs, nestedBytes := replaceBlobValues(v, minLength, minEntropy)
+			blobs += nestedBlobs
+			blobBytes += nestedBytes
+		case string:
+			replaced, n, size := replaceBlobs(v, minLength, minEntropy)
+			if n > 0 {
+				fields[key] = replaced
+				blobs += n
+				blobBytes += size
+			}
+		}
+	}
+	return blobs, blobBytes
+}
@@ -0,0 +1,59 @@
+package sender
+
+import (
+	"encoding/base64"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func randomBase64(size int) string {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestReplaceBlobs(t *testing.T) {
+	blob := randomBase64(300)
+
+	out, blobs, size := replaceBlobs("image: "+blob+" done", 100, defaultBlobMinEntropy)
+	assert.Equal(t, 1, blobs)
+	assert.Equal(t, len(blob), size)
+	assert.Regexp(t, `^image: \[blob: 400 bytes, entropy 5\.\d\d\] done$`, out)
+
+	// Long but low-entropy runs are kept
+	text := strings.Repeat("abcdefgh", 50)
+	out, blobs, _ = replaceBlobs(text, 100, defaultBlobMinEntropy)
+	assert.Equal(t, 0, blobs)
+	assert.Equal(t, text, out)
+
+	// Short runs are kept
+	out, blobs, _ = replaceBlobs(blob[:50], 100, defaultBlobMinEntropy)
+	assert.Equal(t, 0, blobs)
+	assert.Equal(t, blob[:50], out)
+}
+
+func TestProcessMessageReplacesBlobs(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	blob := randomBase64(300)
+	line := myAppPrefix + `{"title":"upload","body":"` + blob + `"}`
+
+	out := decodeOutput(t, sender, line)
+	assert.Equal(t, blob, out["body"])
+
+	sender.blobMinLength = 100
+	out = decodeOutput(t, sender, line)
+	assert.Equal(t, "upload", out["title"])
+	assert.Regexp(t, `^\[blob: 400 bytes, entropy 5\.\d\d\]$`, out["body"])
+	assert.NotContains(t, out["rawlog"], blob)
+	assert.Equal(t, float64(2), out["blobs_removed"])
+	assert.Equal(t, float64(2*len(blob)), out["blob_bytes_removed"])
+
+	// Per-app overrides
+	sender.blobMinLengths = map[string]int{"my-app": 0}
+	out = decodeOutput(t, sender, line)
+	assert.Equal(t, blob, out["body"])
+	assert.NotContains(t, out, "blobs_removed")
+}
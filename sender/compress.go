@@ -0,0 +1,74 @@
+package sender
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+)
+
+// maxRecordSize is the largest record Firehose accepts, 1,000 KiB
+const maxRecordSize = 1000 * 1024
+
+// compressBatch gzips a batch into as few records as possible, each under maxRecordSize.
+// Firehose concatenates the records it delivers to S3, and concatenated gzip members are
+// themselves a valid gzip file.
+func compressBatch(batch [][]byte) ([][]byte, error) {
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	compressed, err := gzipRecords(batch)
+	if err != nil {
+		return nil, err
+	}
+	if len(compressed) <= maxRecordSize || len(batch) == 1 {
+		return [][]byte{compressed}, nil
+	}
+
+	// Too big for one record, so split the batch in half and try again
+	half := len(batch) / 2
+	first, err := compressBatch(batch[:half])
+	if err != nil {
+		return nil, err
+	}
+	second, err := compressBatch(batch[half:])
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
+// gzipRecords concatenates records into a single gzip member
+func gzipRecords(records [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	for _, record := range records {
+		if _, err := zw.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressRecords reverses compressBatch for records that failed to send, so the failed-logs
+// file gets the original logs rather than gzip data
+func decompressRecords(records [][]byte) [][]byte {
+	decompressed := [][]byte{}
+	for _, record := range records {
+		zr, err := gzip.NewReader(bytes.NewReader(record))
+		if err != nil {
+			decompressed = append(decompressed, record)
+			continue
+		}
+		data, err := ioutil.ReadAll(zr)
+		if err != nil {
+			decompressed = append(decompressed, record)
+			continue
+		}
+		decompressed = append(decompressed, data)
+	}
+	return decompressed
+}
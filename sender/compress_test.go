@@ -0,0 +1,73 @@
+package sender
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/firehose"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Clever/kinesis-to-firehose/mocks"
+)
+
+func gunzip(t *testing.T, data []byte) string {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	assert.NoError(t, err)
+	out, err := ioutil.ReadAll(zr)
+	assert.NoError(t, err)
+	return string(out)
+}
+
+func TestCompressBatch(t *testing.T) {
+	compressed, err := compressBatch([][]byte{[]byte("one\n"), []byte("two\n")})
+	assert.NoError(t, err)
+	assert.Len(t, compressed, 1)
+	assert.Equal(t, "one\ntwo\n", gunzip(t, compressed[0]))
+
+	// Random data doesn't compress, so a batch of it must be split across records
+	random := make([]byte, 600*1024)
+	rand.Read(random)
+	compressed, err = compressBatch([][]byte{random, random, []byte("three\n")})
+	assert.NoError(t, err)
+	assert.True(t, len(compressed) > 1)
+	all := []byte{}
+	for _, record := range compressed {
+		assert.True(t, len(record) <= maxRecordSize)
+		all = append(all, record...)
+	}
+	// Concatenated gzip members decompress to the whole batch
+	assert.Equal(t, string(random)+string(random)+"three\n", gunzip(t, all))
+}
+
+func TestSendBatchCompressed(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockFirehoseAPI := mocks.NewMockFirehoseAPI(mockCtrl)
+
+	sender := setupFirehoseSender(t)
+	sender.client = mockFirehoseAPI
+	sender.compressedStreams = map[string]bool{"tester": true}
+
+	mockFirehoseAPI.EXPECT().PutRecordBatch(gomock.Any()).DoAndReturn(
+		func(input *firehose.PutRecordBatchInput) (*firehose.PutRecordBatchOutput, error) {
+			assert.Len(t, input.Records, 1)
+			assert.Equal(t, "one\nthree\n", gunzip(t, input.Records[0].Data))
+			return &firehose.PutRecordBatchOutput{FailedPutCount: aws.Int64(0)}, nil
+		},
+	)
+
+	err := sender.SendBatch([][]byte{[]byte("one\n"), []byte("three\n")}, "tester")
+	assert.NoError(t, err)
+}
+
+func TestDecompressRecords(t *testing.T) {
+	compressed, err := compressBatch([][]byte{[]byte("one\n"), []byte("two\n")})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("one\ntwo\n"), []byte("not gzip")},
+		decompressRecords(append(compressed, []byte("not gzip"))))
+}
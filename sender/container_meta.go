@@ -0,0 +1,181 @@
+package sender
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Policies for container_* fields that a log's payload sets to something other than what its
+// programname says
+const (
+	// OverrideAllow keeps the payload's values
+	OverrideAllow = "allow"
+	// OverrideAudit replaces the payload's values with the programname's values, and records the
+	// payload's values in original_container_* fields
+	OverrideAudit = "audit"
+	// OverrideDeny replaces the payload's values with the programname's values
+	OverrideDeny = "deny"
+)
+
+// escapedTaskARN matches the URL-escaped prefix of an ECS task ARN in any partition (aws,
+// aws-cn, aws-us-gov) and region
+const escapedTaskARN = `arn%3Aaws(-cn|-us-gov)?%3Aecs%3A[a-z]{2}(-gov)?-[a-z]+-[0-9]+%3A[0-9]{12}%3Atask%2F`
+
+// The decode package only understands the EC2-ECS programname format, and only in us-east and
+// us-west. These patterns cover that format in all regions, as well as the other ways our
+// containers identify themselves.
+var containerMetaPatterns = []*regexp.Regexp{
+	// EC2-ECS programnames are `env--app/<escaped task ARN>`
+	regexp.MustCompile(`^(?P<env>[a-z0-9-]+)--(?P<app>[a-z0-9-]+)\/` + // env--app
+		escapedTaskARN + // ARN cruft
+		`(?P<task>[a-z0-9-]+)$`), // task-id
+	// Fargate uses the long task ARN format, which includes the cluster name
+	regexp.MustCompile(`^(?P<env>[a-z0-9-]+)--(?P<app>[a-z0-9-]+)\/` + // env--app
+		escapedTaskARN + // ARN cruft
+		`[a-zA-Z0-9_-]+%2F` + // cluster name
+		`(?P<task>[a-z0-9-]+)$`), // task-id
+	// awslogs-driver stream names are `prefix/container-name/task-id`, where the prefix is env--app
+	regexp.MustCompile(`^(?P<env>[a-z0-9-]+)--(?P<app>[a-z0-9-]+)\/` + // env--app
+		`[a-zA-Z0-9_.-]+\/` + // container name
+		`(?P<task>[a-z0-9-]+)$`), // task-id
+}
+
+// namedMatches returns the values of the named capture groups in re, or nil if s doesn't match
+func namedMatches(re *regexp.Regexp, s string) map[string]string {
+	match := re.FindStringSubmatch(s)
+	if match == nil {
+		return nil
+	}
+
+	groups := map[string]string{}
+	for idx, name := range re.SubexpNames() {
+		if name != "" {
+			groups[name] = match[idx]
+		}
+	}
+	return groups
+}
+
+// containerFields maps the capture groups used by container-metadata patterns to the fields
+// they populate. Any other named groups are emitted as fields of the same name.
+var containerFields = map[string]string{
+	"env":  "container_env",
+	"app":  "container_app",
+	"task": "container_task",
+}
+
+// getContainerMeta returns the named groups of the first container-metadata pattern that
+// matches programname, trying the configured patterns before the built-in ones
+func (f *FirehoseSender) getContainerMeta(programname string) map[string]string {
+	for _, patterns := range [][]*regexp.Regexp{f.containerMetaPatterns, containerMetaPatterns} {
+		for _, re := range patterns {
+			if groups := namedMatches(re, programname); groups != nil {
+				return groups
+			}
+		}
+	}
+	return nil
+}
+
+// addContainerMeta fills in container_env, container_app, and container_task for programnames
+// that decode doesn't recognize, along with any extra named groups in the matching pattern.
+// container_* fields which are already set are left alone.
+func (f *FirehoseSender) addContainerMeta(fields map[string]interface{}) {
+	programname, ok := fields["programname"].(string)
+	if !ok {
+		return
+	}
+
+	for group, val := range f.getContainerMeta(programname) {
+		field, ok := containerFields[group]
+		if !ok {
+			fields[group] = val
+			continue
+		}
+		if _, exists := fields[field]; !exists {
+			fields[field] = val
+		}
+	}
+}
+
+// checkContainerOverrides applies the sender's override policy to container_* fields that were
+// set by the log's payload instead of its programname
+func (f *FirehoseSender) checkContainerOverrides(fields map[string]interface{}) {
+	if f.overridePolicy == "" || f.overridePolicy == OverrideAllow {
+		return
+	}
+
+	programname, ok := fields["programname"].(string)
+	if !ok {
+		return
+	}
+	groups := f.getContainerMeta(programname)
+	if groups == nil {
+		return
+	}
+
+	for group, field := range containerFields {
+		// Patterns without this group say nothing about what the field should be
+		val, captured := groups[group]
+		if !captured {
+			continue
+		}
+		override, ok := fields[field].(string)
+		if !ok || override == val || f.overrideAllowed(groups["app"], override) {
+			continue
+		}
+
+		if f.overridePolicy == OverrideAudit {
+			fields["original_"+field] = override
+		}
+		fields[field] = val
+	}
+}
+
+// overrideAllowed reports whether app is allowlisted to set a container_* field to val
+func (f *FirehoseSender) overrideAllowed(app, val string) bool {
+	for _, allowed := range f.overrideAllowlist[app] {
+		if allowed == "*" || allowed == val {
+			return true
+		}
+	}
+	return false
+}
+
+// nonNormalChars matches runs of characters that aren't allowed in normalized env and app names
+var nonNormalChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// normalizeContainerMeta lowercases container_env and container_app, and replaces any
+// characters other than letters, digits, and dashes with a dash, so that e.g. "My_App" and
+// "my-app" are reported as the same app
+func normalizeContainerMeta(fields map[string]interface{}) {
+	for _, field := range []string{"container_env", "container_app"} {
+		val, ok := fields[field].(string)
+		if !ok {
+			continue
+		}
+		fields[field] = nonNormalChars.ReplaceAllString(strings.ToLower(val), "-")
+	}
+}
+
+// kubeMeta matches Kubernetes log stream names, which are `namespace_pod_container`
+var kubeMeta = regexp.MustCompile(`^(?P<namespace>[a-z0-9-]+)_` + // namespace
+	`(?P<pod>[a-z0-9.-]+)_` + // pod name
+	`(?P<container>[a-z0-9-]+)$`) // container name
+
+// addKubeMeta adds kube_namespace, kube_pod, and kube_container for Kubernetes programnames
+func addKubeMeta(fields map[string]interface{}) {
+	programname, ok := fields["programname"].(string)
+	if !ok {
+		return
+	}
+
+	groups := namedMatches(kubeMeta, programname)
+	if groups == nil {
+		return
+	}
+
+	fields["kube_namespace"] = groups["namespace"]
+	fields["kube_pod"] = groups["pod"]
+	fields["kube_container"] = groups["container"]
+}
@@ -0,0 +1,185 @@
+package sender
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetContainerMeta(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	tests := []struct {
+		programname string
+		expected    map[string]string
+	}{
+		{
+			programname: "production--my-app/arn%3Aaws%3Aecs%3Aus-west-1%3A589690932525%3Atask%2F" +
+				"124cc8a5-0549-4149-922b-cd411b813d11",
+			expected: map[string]string{
+				"env":  "production",
+				"app":  "my-app",
+				"task": "124cc8a5-0549-4149-922b-cd411b813d11",
+			},
+		},
+		{
+			programname: "production--my-app/arn%3Aaws%3Aecs%3Aus-west-1%3A589690932525%3Atask%2F" +
+				"my-cluster%2F0123456789abcdef0123456789abcdef",
+			expected: map[string]string{
+				"env":  "production",
+				"app":  "my-app",
+				"task": "0123456789abcdef0123456789abcdef",
+			},
+		},
+		{
+			programname: "production--my-app/arn%3Aaws%3Aecs%3Aeu-central-1%3A589690932525%3Atask%2F" +
+				"124cc8a5-0549-4149-922b-cd411b813d11",
+			expected: map[string]string{
+				"env":  "production",
+				"app":  "my-app",
+				"task": "124cc8a5-0549-4149-922b-cd411b813d11",
+			},
+		},
+		{
+			programname: "production--my-app/arn%3Aaws-us-gov%3Aecs%3Aus-gov-west-1%3A589690932525%3Atask%2F" +
+				"my-cluster%2F0123456789abcdef0123456789abcdef",
+			expected: map[string]string{
+				"env":  "production",
+				"app":  "my-app",
+				"task": "0123456789abcdef0123456789abcdef",
+			},
+		},
+		{
+			programname: "production--my-app/arn%3Aaws-cn%3Aecs%3Acn-northwest-1%3A589690932525%3Atask%2F" +
+				"124cc8a5-0549-4149-922b-cd411b813d11",
+			expected: map[string]string{
+				"env":  "production",
+				"app":  "my-app",
+				"task": "124cc8a5-0549-4149-922b-cd411b813d11",
+			},
+		},
+		{
+			programname: "clever-dev--my-app/my-app/124cc8a5-0549-4149-922b-cd411b813d11",
+			expected: map[string]string{
+				"env":  "clever-dev",
+				"app":  "my-app",
+				"task": "124cc8a5-0549-4149-922b-cd411b813d11",
+			},
+		},
+		{
+			programname: "docker/0000aa112233",
+			expected:    nil,
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, sender.getContainerMeta(test.programname), test.programname)
+	}
+}
+
+func TestAddContainerMetaKeepsExistingFields(t *testing.T) {
+	fields := map[string]interface{}{
+		"programname":   "production--my-app/my-app/124cc8a5-0549-4149-922b-cd411b813d11",
+		"container_app": "forced-app",
+	}
+	setupFirehoseSender(t).addContainerMeta(fields)
+
+	assert.Equal(t, "production", fields["container_env"])
+	assert.Equal(t, "forced-app", fields["container_app"])
+	assert.Equal(t, "124cc8a5-0549-4149-922b-cd411b813d11", fields["container_task"])
+}
+
+func TestAddContainerMetaCustomPatterns(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	sender.containerMetaPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^(?P<kube_namespace>[a-z0-9-]+)\/(?P<kube_pod>[a-z0-9-]+)$`),
+		regexp.MustCompile(
+			`^(?P<env>[a-z0-9-]+)--(?P<app>[a-z0-9-]+)\/(?P<task>[a-z0-9-]+)\/(?P<revision>[0-9]+)$`),
+	}
+
+	fields := map[string]interface{}{"programname": "production--my-app/124cc8a5/42"}
+	sender.addContainerMeta(fields)
+	assert.Equal(t, "production", fields["container_env"])
+	assert.Equal(t, "my-app", fields["container_app"])
+	assert.Equal(t, "124cc8a5", fields["container_task"])
+	assert.Equal(t, "42", fields["revision"])
+
+	fields = map[string]interface{}{"programname": "kube-system/coredns"}
+	sender.addContainerMeta(fields)
+	assert.Equal(t, "kube-system", fields["kube_namespace"])
+	assert.Equal(t, "coredns", fields["kube_pod"])
+	assert.NotContains(t, fields, "container_app")
+
+	// Built-in patterns are still used when no configured pattern matches
+	fields = map[string]interface{}{
+		"programname": "production--my-app/my-app/124cc8a5-0549-4149-922b-cd411b813d11",
+	}
+	sender.addContainerMeta(fields)
+	assert.Equal(t, "my-app", fields["container_app"])
+	assert.NotContains(t, fields, "revision")
+}
+
+func TestNormalizeContainerMeta(t *testing.T) {
+	fields := map[string]interface{}{
+		"container_env":  "Production",
+		"container_app":  "My_App.v2",
+		"container_task": "ABC",
+	}
+	normalizeContainerMeta(fields)
+
+	assert.Equal(t, "production", fields["container_env"])
+	assert.Equal(t, "my-app-v2", fields["container_app"])
+	assert.Equal(t, "ABC", fields["container_task"])
+}
+
+func TestAddKubeMeta(t *testing.T) {
+	fields := map[string]interface{}{
+		"programname": "kube-system_coredns-5644d7b6d9-9xfz2_coredns",
+	}
+	addKubeMeta(fields)
+
+	assert.Equal(t, "kube-system", fields["kube_namespace"])
+	assert.Equal(t, "coredns-5644d7b6d9-9xfz2", fields["kube_pod"])
+	assert.Equal(t, "coredns", fields["kube_container"])
+
+	fields = map[string]interface{}{"programname": "docker/0000aa112233"}
+	addKubeMeta(fields)
+	assert.NotContains(t, fields, "kube_namespace")
+}
+
+func TestProcessMessageContainerOverrides(t *testing.T) {
+	line := myAppPrefix + `{"title":"a","container_app":"other-app","container_env":"production"}`
+
+	sender := setupFirehoseSender(t)
+	out := decodeOutput(t, sender, line)
+	assert.Equal(t, "other-app", out["container_app"])
+
+	sender.overridePolicy = OverrideAudit
+	out = decodeOutput(t, sender, line)
+	assert.Equal(t, "my-app", out["container_app"])
+	assert.Equal(t, "other-app", out["original_container_app"])
+	assert.NotContains(t, out, "original_container_env")
+
+	sender.overridePolicy = OverrideDeny
+	out = decodeOutput(t, sender, line)
+	assert.Equal(t, "my-app", out["container_app"])
+	assert.NotContains(t, out, "original_container_app")
+
+	sender.overrideAllowlist = map[string][]string{"my-app": {"other-app"}}
+	out = decodeOutput(t, sender, line)
+	assert.Equal(t, "other-app", out["container_app"])
+}
+
+func TestProcessMessageContainerOverridesCustomPatterns(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	sender.overridePolicy = OverrideDeny
+	sender.containerMetaPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^(?P<env>[a-z0-9-]+)--(?P<app>[a-z0-9-]+)\/worker$`),
+	}
+
+	// The pattern has no task group, so the payload's container_task is left alone
+	out := decodeOutput(t, sender, `2017-08-16T04:37:52.901092+00:00 ip-10-0-102-159 `+
+		`production--my-app/worker[3252]: {"container_app":"other-app","container_task":"abc"}`)
+	assert.Equal(t, "my-app", out["container_app"])
+	assert.Equal(t, "abc", out["container_task"])
+}
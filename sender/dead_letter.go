@@ -0,0 +1,90 @@
+package sender
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+
+	kbc "github.com/Clever/amazon-kinesis-client-go/batchconsumer"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+
+	"github.com/Clever/kinesis-to-firehose/sender/stats"
+)
+
+// maxReasonLength is the longest failure reason stored in a dead letter's metadata. S3 limits
+// all of an object's user metadata to 2 KB.
+const maxReasonLength = 1024
+
+// failedRecords returns the records of a batch that weren't delivered because of sendErr
+func failedRecords(batch [][]byte, sendErr error) [][]byte {
+	if partial, ok := sendErr.(kbc.PartialSendBatchError); ok {
+		return partial.FailedMessages
+	}
+	return batch
+}
+
+// failureReason returns the message of the error a batch failed with, without the prefix the
+// consumer library's send errors add to it
+func failureReason(sendErr error) string {
+	switch err := sendErr.(type) {
+	case kbc.PartialSendBatchError:
+		return err.ErrMessage
+	case kbc.CatastrophicSendBatchError:
+		return err.ErrMessage
+	}
+	return sendErr.Error()
+}
+
+// deadLetterKey returns the S3 key that records failed at t are written to, partitioned by
+// stream and hour like Firehose's own S3 keys so backfills can pick a time range
+func (f *FirehoseSender) deadLetterKey(stream string, t time.Time) string {
+	t = t.UTC()
+	name := fmt.Sprintf("%s-%d.gz", f.shardID, t.UnixNano())
+	return path.Join(f.deadLetterPrefix, stream, t.Format("2006/01/02/15"), name)
+}
+
+// sendDeadLetters writes the records of a batch that failed to send to the dead letter bucket,
+// gzipped, with the stream and failure reason in the object's metadata. It returns whether they
+// were written.
+func (f *FirehoseSender) sendDeadLetters(batch [][]byte, stream string, sendErr error) bool {
+	records := failedRecords(batch, sendErr)
+	if len(records) == 0 {
+		return true
+	}
+
+	data, err := gzipRecords(records)
+	if err != nil {
+		log.ErrorD("gzip-dead-letters", logger.M{"stream": stream, "error": err.Error()})
+		return false
+	}
+
+	key := f.deadLetterKey(stream, time.Now())
+	_, err = f.s3Client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(f.deadLetterBucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/gzip"),
+		Metadata: map[string]*string{
+			"stream":       aws.String(stream),
+			"shard-id":     aws.String(f.shardID),
+			"record-count": aws.String(strconv.Itoa(len(records))),
+			"reason":       aws.String(truncateUTF8(failureReason(sendErr), maxReasonLength)),
+		},
+	})
+	if err != nil {
+		log.ErrorD("send-dead-letters", logger.M{
+			"stream": stream, "bucket": f.deadLetterBucket, "key": key, "error": err.Error(),
+		})
+		return false
+	}
+
+	stats.Counter("dead-lettered-records", len(records))
+	log.WarnD("dead-lettered-records", logger.M{
+		"stream": stream, "bucket": f.deadLetterBucket, "key": key, "record-count": len(records),
+	})
+	return true
+}
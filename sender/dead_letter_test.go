@@ -0,0 +1,98 @@
+package sender
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	kbc "github.com/Clever/amazon-kinesis-client-go/batchconsumer"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/firehose"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Clever/kinesis-to-firehose/mocks"
+)
+
+func TestFailedRecords(t *testing.T) {
+	batch := [][]byte{[]byte("one"), []byte("two")}
+	partial := kbc.PartialSendBatchError{FailedMessages: [][]byte{[]byte("two")}}
+	assert.Equal(t, [][]byte{[]byte("two")}, failedRecords(batch, partial))
+	assert.Equal(t, batch, failedRecords(batch, kbc.CatastrophicSendBatchError{}))
+}
+
+func TestFailureReason(t *testing.T) {
+	assert.Equal(t, "firehose is down",
+		failureReason(kbc.CatastrophicSendBatchError{ErrMessage: "firehose is down"}))
+	assert.Equal(t, "too many retries",
+		failureReason(kbc.PartialSendBatchError{ErrMessage: "too many retries"}))
+	assert.Equal(t, "other", failureReason(fmt.Errorf("other")))
+}
+
+func TestDeadLetterKey(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	sender.deadLetterPrefix = "dead-letters"
+	sender.Initialize("shard-0001")
+
+	at := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+	assert.Equal(t, fmt.Sprintf("dead-letters/tester/2019/03/04/05/shard-0001-%d.gz", at.UnixNano()),
+		sender.deadLetterKey("tester", at))
+}
+
+func TestSendBatchWritesDeadLetters(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockFirehoseAPI := mocks.NewMockFirehoseAPI(mockCtrl)
+	mockS3API := mocks.NewMockS3API(mockCtrl)
+
+	sender := setupFirehoseSender(t)
+	sender.client = mockFirehoseAPI
+	sender.s3Client = mockS3API
+	sender.deadLetterBucket = "dead-letter-bucket"
+	sender.Initialize("shard-0001")
+
+	mockFirehoseAPI.EXPECT().PutRecordBatch(gomock.Any()).Return(nil, fmt.Errorf("firehose is down"))
+	mockS3API.EXPECT().PutObject(gomock.Any()).DoAndReturn(
+		func(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			assert.Equal(t, "dead-letter-bucket", aws.StringValue(input.Bucket))
+			assert.Equal(t, "tester", aws.StringValue(input.Metadata["stream"]))
+			assert.Equal(t, "2", aws.StringValue(input.Metadata["record-count"]))
+			assert.Equal(t, "firehose is down", aws.StringValue(input.Metadata["reason"]))
+
+			data, err := ioutil.ReadAll(input.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, "one\ntwo\n", gunzip(t, data))
+			return &s3.PutObjectOutput{}, nil
+		},
+	)
+
+	err := sender.SendBatch([][]byte{[]byte("one\n"), []byte("two\n")}, "tester")
+	assert.NoError(t, err)
+}
+
+func TestSendBatchDeadLettersFail(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockFirehoseAPI := mocks.NewMockFirehoseAPI(mockCtrl)
+	mockS3API := mocks.NewMockS3API(mockCtrl)
+
+	sender := setupFirehoseSender(t)
+	sender.client = mockFirehoseAPI
+	sender.s3Client = mockS3API
+	sender.deadLetterBucket = "dead-letter-bucket"
+
+	mockFirehoseAPI.EXPECT().PutRecordBatch(gomock.Any()).DoAndReturn(
+		func(input *firehose.PutRecordBatchInput) (*firehose.PutRecordBatchOutput, error) {
+			return failRecords(input, "two\n"), nil
+		},
+	)
+	mockS3API.EXPECT().PutObject(gomock.Any()).Return(nil, fmt.Errorf("s3 is down"))
+
+	// Records that couldn't be dead-lettered are still reported to the consumer
+	err := sender.SendBatch([][]byte{[]byte("one\n"), []byte("two\n")}, "tester")
+	partial, ok := err.(kbc.PartialSendBatchError)
+	assert.True(t, ok)
+	assert.Equal(t, [][]byte{[]byte("two\n")}, partial.FailedMessages)
+}
@@ -0,0 +1,44 @@
+package sender
+
+import (
+	"fmt"
+)
+
+// Record delimiters, which separate the JSON records written to a Firehose stream
+const (
+	// DelimiterNewline ends each record with a newline, so records appear one per line
+	DelimiterNewline = "newline"
+	// DelimiterNone writes records without a delimiter
+	DelimiterNone = "none"
+	// DelimiterRFC7464 starts each record with an ASCII record separator and ends it with a
+	// newline, as in RFC 7464 JSON text sequences
+	DelimiterRFC7464 = "rfc7464"
+)
+
+// recordSeparator is the ASCII RS character which starts RFC 7464 records
+const recordSeparator = 0x1E
+
+// validateDelimiter returns an error if delimiter isn't one of the known record delimiters
+func validateDelimiter(delimiter string) error {
+	switch delimiter {
+	case "", DelimiterNewline, DelimiterNone, DelimiterRFC7464:
+		return nil
+	}
+	return fmt.Errorf("unknown record delimiter '%s'", delimiter)
+}
+
+// delimit adds the delimiter configured for stream to a serialized record
+func (f *FirehoseSender) delimit(stream string, msg []byte) []byte {
+	delimiter, ok := f.streamDelimiters[stream]
+	if !ok {
+		delimiter = f.delimiter
+	}
+
+	switch delimiter {
+	case DelimiterNone:
+		return msg
+	case DelimiterRFC7464:
+		return append(append([]byte{recordSeparator}, msg...), '\n')
+	}
+	return append(msg, '\n')
+}
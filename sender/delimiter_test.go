@@ -0,0 +1,25 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelimit(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	msg := func() []byte { return []byte(`{"title":"a"}`) }
+
+	assert.Equal(t, "{\"title\":\"a\"}\n", string(sender.delimit("logs", msg())))
+
+	sender.delimiter = DelimiterNone
+	sender.streamDelimiters = map[string]string{"metrics": DelimiterRFC7464}
+	assert.Equal(t, `{"title":"a"}`, string(sender.delimit("logs", msg())))
+	assert.Equal(t, "\x1e{\"title\":\"a\"}\n", string(sender.delimit("metrics", msg())))
+}
+
+func TestValidateDelimiter(t *testing.T) {
+	assert.NoError(t, validateDelimiter(""))
+	assert.NoError(t, validateDelimiter(DelimiterRFC7464))
+	assert.EqualError(t, validateDelimiter("tab"), "unknown record delimiter 'tab'")
+}
@@ -0,0 +1,131 @@
+package sender
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// derivedField is a field computed from the other fields of a log
+type derivedField struct {
+	name string
+	// eval returns the field's value, or false if a field it depends on is missing
+	eval func(fields map[string]interface{}) (interface{}, bool)
+}
+
+// derivedFieldDef matches a derived field definition, e.g. `service := {{env}}--{{app}}`
+var derivedFieldDef = regexp.MustCompile(`^\s*([A-Za-z0-9_.\-]+)\s*:=\s*(.+?)\s*$`)
+
+// templateField matches a field reference in a template, e.g. `{{container_app}}`
+var templateField = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.\-]+)\s*\}\}`)
+
+// bucketExpr matches a bucketing expression, e.g. `bucket(duration, [10,100,1000])`
+var bucketExpr = regexp.MustCompile(`^bucket\(\s*([A-Za-z0-9_.\-]+)\s*,\s*\[([^\]]*)\]\s*\)$`)
+
+// parseDerivedField parses a definition of the form `name := template` or
+// `name := bucket(field, [bounds])`
+func parseDerivedField(def string) (derivedField, error) {
+	match := derivedFieldDef.FindStringSubmatch(def)
+	if match == nil {
+		return derivedField{}, fmt.Errorf("invalid derived field '%s': must be 'name := expression'", def)
+	}
+	name, expr := match[1], match[2]
+
+	if bucket := bucketExpr.FindStringSubmatch(expr); bucket != nil {
+		bounds := []float64{}
+		for _, str := range strings.Split(bucket[2], ",") {
+			str = strings.TrimSpace(str)
+			bound, err := strconv.ParseFloat(str, 64)
+			if err != nil {
+				return derivedField{}, fmt.Errorf("invalid bucket bound '%s' in derived field '%s'", str, name)
+			}
+			bounds = append(bounds, bound)
+		}
+		if !sort.Float64sAreSorted(bounds) {
+			return derivedField{}, fmt.Errorf("bucket bounds in derived field '%s' must be ascending", name)
+		}
+		return derivedField{name: name, eval: bucketEval(bucket[1], bounds)}, nil
+	}
+
+	if strings.HasPrefix(expr, "bucket(") {
+		return derivedField{}, fmt.Errorf("invalid bucket expression in derived field '%s'", name)
+	}
+	return derivedField{name: name, eval: templateEval(expr)}, nil
+}
+
+// templateEval returns an eval func which replaces the field references in tmpl with the
+// fields' values
+func templateEval(tmpl string) func(map[string]interface{}) (interface{}, bool) {
+	return func(fields map[string]interface{}) (interface{}, bool) {
+		ok := true
+		val := templateField.ReplaceAllStringFunc(tmpl, func(ref string) string {
+			parent, key, found := lookupField(fields, templateField.FindStringSubmatch(ref)[1])
+			if !found {
+				ok = false
+				return ""
+			}
+			return formatValue(parent[key])
+		})
+		return val, ok
+	}
+}
+
+// bucketEval returns an eval func which labels a numeric field with the bucket it falls in,
+// e.g. "<10", "10-100", or ">=1000" for bounds [10, 100, 1000]
+func bucketEval(field string, bounds []float64) func(map[string]interface{}) (interface{}, bool) {
+	return func(fields map[string]interface{}) (interface{}, bool) {
+		parent, key, found := lookupField(fields, field)
+		if !found {
+			return nil, false
+		}
+		var num float64
+		switch v := parent[key].(type) {
+		case float64:
+			num = v
+		case int:
+			num = float64(v)
+		case json.Number:
+			// Integers too large for a float64 are kept as json.Numbers by preserve-integers
+			var err error
+			if num, err = v.Float64(); err != nil {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+
+		if num < bounds[0] {
+			return "<" + formatValue(bounds[0]), true
+		}
+		for idx := 1; idx < len(bounds); idx++ {
+			if num < bounds[idx] {
+				return formatValue(bounds[idx-1]) + "-" + formatValue(bounds[idx]), true
+			}
+		}
+		return ">=" + formatValue(bounds[len(bounds)-1]), true
+	}
+}
+
+// formatValue formats a field value for use in a derived field
+func formatValue(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(val)
+}
+
+// addDerivedFields computes the sender's derived fields, in order, so later ones can use earlier
+// ones. Fields which already exist, or which depend on missing fields, are skipped.
+func (f *FirehoseSender) addDerivedFields(fields map[string]interface{}) {
+	for _, derived := range f.derivedFields {
+		if val, ok := derived.eval(fields); ok {
+			setDefault(fields, derived.name, val)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddDerivedFields(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	for _, def := range []string{
+		"service := {{container_env}}--{{container_app}}",
+		"latency_bucket := bucket(duration, [10, 100, 1000])",
+		"route := {{ service }} {{request.path}}",
+		"missing := {{no_such_field}}",
+	} {
+		derived, err := parseDerivedField(def)
+		assert.NoError(t, err)
+		sender.derivedFields = append(sender.derivedFields, derived)
+	}
+
+	fields := map[string]interface{}{
+		"container_env": "production",
+		"container_app": "my-app",
+		"duration":      float64(250),
+		"request":       map[string]interface{}{"path": "/health"},
+	}
+	sender.addDerivedFields(fields)
+	assert.Equal(t, "production--my-app", fields["service"])
+	assert.Equal(t, "100-1000", fields["latency_bucket"])
+	assert.Equal(t, "production--my-app /health", fields["route"])
+	assert.NotContains(t, fields, "missing")
+
+	for duration, bucket := range map[float64]string{5: "<10", 10: "10-100", 1000: ">=1000", 0.5: "<10"} {
+		fields := map[string]interface{}{"duration": duration}
+		sender.addDerivedFields(fields)
+		assert.Equal(t, bucket, fields["latency_bucket"], duration)
+	}
+
+	// Existing fields are left alone
+	fields = map[string]interface{}{"container_env": "a", "container_app": "b", "service": "mine"}
+	sender.addDerivedFields(fields)
+	assert.Equal(t, "mine", fields["service"])
+}
+
+func TestParseDerivedFieldErrors(t *testing.T) {
+	_, err := parseDerivedField("service = {{app}}")
+	assert.EqualError(t, err, "invalid derived field 'service = {{app}}': must be 'name := expression'")
+	_, err = parseDerivedField("b := bucket(duration, [10, ten])")
+	assert.EqualError(t, err, "invalid bucket bound 'ten' in derived field 'b'")
+	_, err = parseDerivedField("b := bucket(duration, [100, 10])")
+	assert.EqualError(t, err, "bucket bounds in derived field 'b' must be ascending")
+	_, err = parseDerivedField("b := bucket(duration)")
+	assert.EqualError(t, err, "invalid bucket expression in derived field 'b'")
+}
+
+func TestProcessMessageBucketsLargeIntegers(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	derived, err := parseDerivedField("size_bucket := bucket(size, [10, 100, 1000])")
+	assert.NoError(t, err)
+	sender.derivedFields = []derivedField{derived}
+
+	out := decodeOutput(t, sender, myAppPrefix+`{"title":"upload","size":9007199254740993}`)
+	assert.Equal(t, ">=1000", out["size_bucket"])
+	out = decodeOutput(t, sender, myAppPrefix+`{"title":"upload","size":42}`)
+	assert.Equal(t, "10-100", out["size_bucket"])
+}
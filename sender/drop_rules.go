@@ -0,0 +1,80 @@
+package sender
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/Clever/kinesis-to-firehose/sender/stats"
+)
+
+// DropRule matches noisy logs, such as health checks, which are dropped instead of sent. A log
+// matches if it matches every condition that is set.
+type DropRule struct {
+	// Name identifies the rule in the dropped-by-rule counters
+	Name string `json:"name"`
+	// App matches container_app exactly
+	App string `json:"app"`
+	// Title matches the Kayvee title exactly
+	Title string `json:"title"`
+	// Level matches the Kayvee level exactly
+	Level string `json:"level"`
+	// Rawlog is a regex matched against rawlog
+	Rawlog string `json:"rawlog"`
+}
+
+// dropRule is a DropRule with its regex compiled
+type dropRule struct {
+	DropRule
+	rawlog *regexp.Regexp
+}
+
+// newDropRule compiles a DropRule. Rules without any conditions are rejected, since they would
+// drop every log.
+func newDropRule(rule DropRule) (dropRule, error) {
+	if rule.App == "" && rule.Title == "" && rule.Level == "" && rule.Rawlog == "" {
+		return dropRule{}, fmt.Errorf("drop rule '%s' has no conditions", rule.Name)
+	}
+
+	compiled := dropRule{DropRule: rule}
+	if rule.Rawlog != "" {
+		re, err := regexp.Compile(rule.Rawlog)
+		if err != nil {
+			return dropRule{}, fmt.Errorf("drop rule '%s' has an invalid rawlog regex: %s", rule.Name, err)
+		}
+		compiled.rawlog = re
+	}
+	return compiled, nil
+}
+
+// matches returns true if a log matches every condition of the rule
+func (r dropRule) matches(fields map[string]interface{}) bool {
+	for field, want := range map[string]string{
+		"container_app": r.App,
+		"title":         r.Title,
+		"level":         r.Level,
+	} {
+		if want != "" && fields[field] != want {
+			return false
+		}
+	}
+
+	if r.rawlog != nil {
+		rawlog, ok := fields["rawlog"].(string)
+		if !ok || !r.rawlog.MatchString(rawlog) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDropRules returns false if a log matches one of the sender's drop rules, and counts it
+// under the first matching rule's name
+func (f *FirehoseSender) checkDropRules(fields map[string]interface{}) bool {
+	for _, rule := range f.dropRules {
+		if rule.matches(fields) {
+			stats.Counter("dropped-by-rule-"+rule.Name, 1)
+			return false
+		}
+	}
+	return true
+}
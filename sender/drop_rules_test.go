@@ -0,0 +1,37 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDropRules(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	for _, rule := range []DropRule{
+		{Name: "elb-health", Rawlog: `ELB-HealthChecker/\d`},
+		{Name: "debug-pings", App: "my-app", Title: "ping", Level: "debug"},
+	} {
+		compiled, err := newDropRule(rule)
+		assert.NoError(t, err)
+		sender.dropRules = append(sender.dropRules, compiled)
+	}
+
+	assert.False(t, sender.checkDropRules(map[string]interface{}{
+		"rawlog": `10.0.0.1 - - "GET /health HTTP/1.1" 200 "ELB-HealthChecker/2.0"`,
+	}))
+	assert.False(t, sender.checkDropRules(map[string]interface{}{
+		"container_app": "my-app", "title": "ping", "level": "debug",
+	}))
+	assert.True(t, sender.checkDropRules(map[string]interface{}{
+		"container_app": "my-app", "title": "ping", "level": "info",
+	}))
+	assert.True(t, sender.checkDropRules(map[string]interface{}{"rawlog": "GET /users"}))
+}
+
+func TestNewDropRuleErrors(t *testing.T) {
+	_, err := newDropRule(DropRule{Name: "everything"})
+	assert.EqualError(t, err, "drop rule 'everything' has no conditions")
+	_, err = newDropRule(DropRule{Name: "bad", Rawlog: "("})
+	assert.Error(t, err)
+}
@@ -0,0 +1,55 @@
+package sender
+
+import (
+	"errors"
+
+	"github.com/Clever/amazon-kinesis-client-go/decode"
+)
+
+// Classes of failure, for use with errors.Is on the errors returned by Decode and ProcessMessage
+var (
+	// ErrNotSyslog means the line couldn't be parsed as syslog, or as a fluentbit JSON log
+	ErrNotSyslog = errors.New("not a syslog line")
+	// ErrRejected means the line parsed as a fluentbit JSON log, but decode rejected it, e.g.
+	// because it has no timestamp or log field
+	ErrRejected = errors.New("rejected by decode")
+	// ErrRecordTooLarge means the line's record is over Firehose's 1,000 KiB limit, and was
+	// dropped by the OversizedDrop policy
+	ErrRecordTooLarge = errors.New("record too large")
+)
+
+// DecodeError is a failure to turn a line into a record, classified as one of ErrNotSyslog,
+// ErrRejected, or ErrRecordTooLarge. errors.Is matches its class, and errors.As can reach the
+// underlying error.
+type DecodeError struct {
+	// Class is the sentinel error for the kind of failure
+	Class error
+	// Err is the underlying error
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return e.Class.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the error's class
+func (e *DecodeError) Is(target error) bool {
+	return target == e.Class
+}
+
+// classifyDecodeError wraps an error from decode.ParseAndEnhance in a DecodeError. decode's
+// errors are untyped, so they're classified by whether the line parses as syslog or fluentbit on
+// its own, rather than by their messages.
+func classifyDecodeError(line string, err error) error {
+	_, syslogErr := decode.FieldsFromSyslog(line)
+	_, fluentErr := decode.FieldsFromFluentbitLog(line)
+	if syslogErr != nil && fluentErr != nil {
+		return &DecodeError{Class: ErrNotSyslog, Err: err}
+	}
+	return &DecodeError{Class: ErrRejected, Err: err}
+}
@@ -0,0 +1,36 @@
+package sender
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeReturnsClassifiedErrors(t *testing.T) {
+	sender := setupFirehoseSender(t)
+
+	_, _, err := sender.Decode([]byte("not a syslog line"))
+	assert.True(t, errors.Is(err, ErrNotSyslog))
+	assert.False(t, errors.Is(err, ErrRejected))
+
+	// fluentbit logs parse as JSON, but need a timestamp and a log
+	_, _, err = sender.Decode([]byte(`{"log":"a","fluent_ts":"yesterday"}`))
+	assert.True(t, errors.Is(err, ErrRejected))
+	assert.False(t, errors.Is(err, ErrNotSyslog))
+	var decodeErr *DecodeError
+	assert.True(t, errors.As(err, &decodeErr))
+
+	_, _, err = sender.Decode([]byte(`{"fluent_ts":"2020-08-18T15:44:17.000-0700"}`))
+	assert.True(t, errors.Is(err, ErrRejected))
+}
+
+func TestProcessMessageRecordTooLarge(t *testing.T) {
+	sender := setupFirehoseSender(t)
+
+	line := `2017-08-16T04:37:52.901092+00:00 ip-10-0-102-159 my-app[3252]: {"body":"` +
+		strings.Repeat("x", maxRecordSize) + `"}`
+	_, _, err := sender.ProcessMessage([]byte(line))
+	assert.True(t, errors.Is(err, ErrRecordTooLarge))
+}
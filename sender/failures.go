@@ -0,0 +1,61 @@
+package sender
+
+import (
+	"errors"
+	"time"
+
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+
+	"github.com/Clever/kinesis-to-firehose/sender/stats"
+)
+
+// failureClasses name the classes of decode failure in the decode-failures counters
+var failureClasses = map[error]string{
+	ErrNotSyslog:      "not-syslog",
+	ErrRejected:       "rejected",
+	ErrRecordTooLarge: "record-too-large",
+}
+
+// maxFailureSampleLength is the most of a failing line that's logged in a sample
+const maxFailureSampleLength = 1000
+
+// failureClass returns the counter name for an error from Decode
+func failureClass(err error) string {
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		if name, ok := failureClasses[decodeErr.Class]; ok {
+			return name
+		}
+	}
+	return "other"
+}
+
+// countFailure counts a line that failed to process by its class of failure, and logs it as a
+// sample if fewer than the sender's failure samples have been logged this minute
+func (f *FirehoseSender) countFailure(rawlog []byte, err error) {
+	class := failureClass(err)
+	stats.Counter("decode-failures-"+class, 1)
+	if f.failureSamples <= 0 {
+		return
+	}
+
+	f.failureSampleLock.Lock()
+	now := time.Now()
+	if now.Sub(f.failureSampleStart) >= time.Minute {
+		f.failureSampleStart = now
+		f.failureSampleCount = 0
+	}
+	sample := f.failureSampleCount < f.failureSamples
+	if sample {
+		f.failureSampleCount++
+	}
+	f.failureSampleLock.Unlock()
+
+	if sample {
+		log.WarnD("decode-failure-sample", logger.M{
+			"class": class,
+			"error": err.Error(),
+			"line":  truncateUTF8(string(rawlog), maxFailureSampleLength),
+		})
+	}
+}
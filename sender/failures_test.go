@@ -0,0 +1,31 @@
+package sender
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureClass(t *testing.T) {
+	assert.Equal(t, "not-syslog", failureClass(&DecodeError{Class: ErrNotSyslog, Err: fmt.Errorf("x")}))
+	assert.Equal(t, "record-too-large",
+		failureClass(&DecodeError{Class: ErrRecordTooLarge, Err: fmt.Errorf("x")}))
+	assert.Equal(t, "other", failureClass(fmt.Errorf("x")))
+}
+
+func TestCountFailureSamples(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	for idx := 0; idx < 3; idx++ {
+		_, _, err := sender.ProcessMessage([]byte("not a syslog line"))
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 0, sender.failureSampleCount)
+
+	sender.failureSamples = 2
+	for idx := 0; idx < 3; idx++ {
+		_, _, err := sender.ProcessMessage([]byte("not a syslog line"))
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 2, sender.failureSampleCount)
+}
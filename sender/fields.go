@@ -0,0 +1,49 @@
+package sender
+
+import (
+	"strconv"
+	"strings"
+)
+
+// setDefault sets a field unless it already has a value
+func setDefault(fields map[string]interface{}, field string, val interface{}) {
+	if _, ok := fields[field]; !ok {
+		fields[field] = val
+	}
+}
+
+// lookupField finds a field by its dotted path (e.g. "user.id"), returning the object that
+// contains it and its key in that object
+func lookupField(fields map[string]interface{}, path string) (map[string]interface{}, string, bool) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		nested, ok := fields[part].(map[string]interface{})
+		if !ok {
+			return nil, "", false
+		}
+		fields = nested
+	}
+
+	key := parts[len(parts)-1]
+	if _, ok := fields[key]; !ok {
+		return nil, "", false
+	}
+	return fields, key, true
+}
+
+// setParsedFields adds the groups a parser matched to fields, converting intFields to ints.
+// Empty and "-" (unset) values are skipped, and existing fields are left alone.
+func setParsedFields(fields map[string]interface{}, matches map[string]string, intFields map[string]bool) {
+	for field, val := range matches {
+		if val == "" || val == "-" {
+			continue
+		}
+		if !intFields[field] {
+			setDefault(fields, field, val)
+			continue
+		}
+		if num, err := strconv.Atoi(strings.TrimPrefix(val, "+")); err == nil {
+			setDefault(fields, field, num)
+		}
+	}
+}
@@ -2,16 +2,25 @@ package sender
 
 import (
 	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
 	"github.com/aws/aws-sdk-go/service/firehose"
 	iface "github.com/aws/aws-sdk-go/service/firehose/firehoseiface"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 
 	kbc "github.com/Clever/amazon-kinesis-client-go/batchconsumer"
 	"github.com/Clever/amazon-kinesis-client-go/decode"
 	"gopkg.in/Clever/kayvee-go.v6/logger"
+
+	"github.com/Clever/kinesis-to-firehose/sender/stats"
 )
 
 var log = logger.New("kinesis-to-firehose")
@@ -21,6 +30,67 @@ type FirehoseSender struct {
 	streamName string
 	deployEnv  string
 	client     iface.FirehoseAPI
+	stages     []Stage
+	shardID    string
+
+	containerMetaPatterns []*regexp.Regexp
+	overridePolicy        string
+	overrideAllowlist     map[string][]string
+	skipNormalize         bool
+	maxClockSkew          time.Duration
+	futureTimestampPolicy string
+	metricStreamsByType   map[string]string
+	metricStreamsByTitle  map[string]string
+	maxFieldLength        int
+	fieldMaxLengths       map[string]int
+	blobMinLength         int
+	blobMinLengths        map[string]int
+	blobMinEntropy        float64
+	hashedFields          []string
+	hashKey               []byte
+	base64Fields          []string
+	maxLineLength         int
+	manifestStream        string
+	flatten               bool
+	flattenSeparator      string
+	flattenMaxDepth       int
+	omitRawPolicy         string
+	delimiter             string
+	streamDelimiters      map[string]string
+	validateKayveeSchema  bool
+	quarantineStream      string
+	haproxyApps           map[string]bool
+	blankLinePolicy       string
+	blankLinePolicies     map[string]string
+	normalizeInteriorCR   bool
+	keyValueApps          map[string]bool
+	keyValuePrefix        string
+	derivedFields         []derivedField
+	arrayPayloadField     string
+	arrayPayloadFields    map[string]string
+	dropRules             []dropRule
+	requestIDAliases      []string
+
+	ec2Client        ec2iface.EC2API
+	instanceMeta     map[string]cachedInstanceMeta
+	instanceMetaLock sync.Mutex
+	// instanceMetaLookups tracks background instance lookups, so tests can wait for them
+	instanceMetaLookups sync.WaitGroup
+
+	compressedStreams     map[string]bool
+	oversizedRecordPolicy string
+	maxRetries            int
+	// sleep waits out the backoff between retries; tests replace it so they don't have to wait
+	sleep func(time.Duration)
+
+	s3Client         s3iface.S3API
+	deadLetterBucket string
+	deadLetterPrefix string
+
+	failureSamples     int
+	failureSampleStart time.Time
+	failureSampleCount int
+	failureSampleLock  sync.Mutex
 }
 
 // FirehoseSenderConfig is the set of config options used in NewFirehoseWriter
@@ -34,13 +104,252 @@ type FirehoseSenderConfig struct {
 	StreamName string
 	// Endpoint is the firehose endpoint to use
 	Endpoint string
+	// Stages are the names of the stages to run on each decoded log, in order.
+	// Defaults to DefaultStages.
+	Stages []string
+	// ContainerMetaPatterns are programname regexes tried, in order, before the built-in
+	// container-metadata patterns. The named groups env, app, and task populate the container_*
+	// fields; any other named groups are emitted as fields of the same name.
+	ContainerMetaPatterns []string
+	// ContainerOverridePolicy is what to do when a log's payload sets a container_* field to
+	// something other than what its programname says: OverrideAllow (the default),
+	// OverrideAudit, or OverrideDeny.
+	ContainerOverridePolicy string
+	// ContainerOverrideAllowlist maps an app to the container_* values it may always set in
+	// its payload, regardless of ContainerOverridePolicy. "*" allows any value.
+	ContainerOverrideAllowlist map[string][]string
+	// SkipContainerNormalization disables lowercasing and character substitution of
+	// container_env and container_app
+	SkipContainerNormalization bool
+	// MaxClockSkew is how far in the future a log's timestamp may be before
+	// FutureTimestampPolicy is applied to it. Zero disables the check.
+	MaxClockSkew time.Duration
+	// FutureTimestampPolicy is what to do with logs past MaxClockSkew: FutureTimestampDrop (the
+	// default) or FutureTimestampClamp.
+	FutureTimestampPolicy string
+	// MetricStreamsByType maps a Kayvee metric type ("gauge" or "counter") to the Firehose
+	// stream its logs are sent to, instead of StreamName
+	MetricStreamsByType map[string]string
+	// MetricStreamsByTitle maps a Kayvee metric's title to the Firehose stream its logs are sent
+	// to. It takes precedence over MetricStreamsByType.
+	MetricStreamsByTitle map[string]string
+	// MaxFieldLength is the longest a string value may be, in bytes, before it is truncated.
+	// Zero disables truncation.
+	MaxFieldLength int
+	// FieldMaxLengths overrides MaxFieldLength for specific fields, by dotted path. Zero disables
+	// truncation for that field.
+	FieldMaxLengths map[string]int
+	// BlobMinLength is the shortest run of base64 characters that is checked for being an
+	// encoded blob. Blobs are replaced with a placeholder. Zero disables blob detection.
+	BlobMinLength int
+	// BlobMinLengths overrides BlobMinLength for specific apps
+	BlobMinLengths map[string]int
+	// BlobMinEntropy is the entropy, in bits per character, at which a run of base64 characters
+	// is considered a blob. Defaults to 5.
+	BlobMinEntropy float64
+	// HashedFields are the dotted paths of fields whose values are replaced with their
+	// HMAC-SHA256, keyed with HashKey
+	HashedFields []string
+	// HashKey is the HMAC key for HashedFields
+	HashKey []byte
+	// Base64Fields are the dotted paths of fields holding base64-encoded JSON, which is decoded
+	// into structured fields
+	Base64Fields []string
+	// MaxLineLength is the longest a raw log line may be, in bytes. Longer lines are truncated
+	// and marked with truncated=true. Zero disables truncation.
+	MaxLineLength int
+	// ManifestStream is the Firehose stream that a manifest record (shard ID, record count, and
+	// byte size) is written to for each batch sent. Empty disables manifests.
+	ManifestStream string
+	// FlattenNested replaces nested objects with top-level fields named by their path, e.g.
+	// {"nested":{"a":"b"}} becomes {"nested.a":"b"}
+	FlattenNested bool
+	// FlattenSeparator joins the keys of flattened objects. Defaults to ".".
+	FlattenSeparator string
+	// FlattenMaxDepth is how many levels of nesting are flattened. Deeper objects are kept as
+	// JSON strings. Zero means no limit.
+	FlattenMaxDepth int
+	// OmitRawFields is which logs rawlog, prefix, and postfix are dropped from: OmitRawNone (the
+	// default), OmitRawKayvee, or OmitRawAll
+	OmitRawFields string
+	// RecordDelimiter separates the records written to Firehose: DelimiterNewline (the default),
+	// DelimiterNone, or DelimiterRFC7464
+	RecordDelimiter string
+	// StreamDelimiters overrides RecordDelimiter for specific Firehose streams
+	StreamDelimiters map[string]string
+	// ValidateKayvee marks Kayvee logs missing a string title, source, or level with
+	// kv_invalid=true
+	ValidateKayvee bool
+	// QuarantineStream is the Firehose stream that logs marked kv_invalid are sent to. Empty
+	// sends them to StreamName with everything else.
+	QuarantineStream string
+	// HaproxyApps are the container apps whose non-Kayvee logs are parsed as haproxy HTTP logs
+	HaproxyApps []string
+	// BlankLinePolicy is what to do with logs whose message is empty or only whitespace:
+	// BlankLineKeep (the default), BlankLineSkip, or BlankLinePlaceholder
+	BlankLinePolicy string
+	// BlankLinePolicies overrides BlankLinePolicy for specific apps
+	BlankLinePolicies map[string]string
+	// NormalizeInteriorCR replaces CRLF and lone CR line endings inside logs with LF. Trailing
+	// line endings are always stripped.
+	NormalizeInteriorCR bool
+	// KeyValueApps are the container apps whose non-Kayvee logs have key=value pairs extracted
+	// into fields. "*" matches every app.
+	KeyValueApps []string
+	// KeyValuePrefix is prepended to the names of fields extracted from key=value pairs.
+	// Defaults to "kv_".
+	KeyValuePrefix string
+	// DerivedFields define fields computed from other fields, in order, as `name := template`
+	// (e.g. `service := {{container_env}}--{{container_app}}`) or `name := bucket(field, [bounds])`
+	// (e.g. `latency_bucket := bucket(duration, [10,100,1000])`)
+	DerivedFields []string
+	// ArrayPayloadField is the field that logs whose payload is a JSON array, rather than a
+	// Kayvee object, have the array put under. Empty leaves them as unparsed rawlogs.
+	ArrayPayloadField string
+	// ArrayPayloadFields overrides ArrayPayloadField for specific apps
+	ArrayPayloadFields map[string]string
+	// DropRules match noisy logs, such as health checks, which are dropped instead of sent
+	DropRules []DropRule
+	// InstanceMetaRegion is the region of the EC2 instances writing logs. When set, each log is
+	// tagged with the instance ID, availability zone, and instance type of its host.
+	InstanceMetaRegion string
+	// RequestIDAliases are the field names, matched case-insensitively, whose values are copied
+	// into request_id. Defaults to req_id, requestId, request-id, x-request-id, and x_request_id.
+	RequestIDAliases []string
+	// FailureSamples is the most lines that failed to decode which are logged, as
+	// decode-failure-sample, per minute. Failures are always counted by class.
+	FailureSamples int
+	// CompressedStreams are the Firehose streams whose batches are gzipped into as few records as
+	// possible. Only use this for streams delivering to S3.
+	CompressedStreams []string
+	// OversizedRecordPolicy is what to do with records over Firehose's 1,000 KiB limit:
+	// OversizedDrop (the default) or OversizedTruncate.
+	OversizedRecordPolicy string
+	// MaxRetries is the most times records that Firehose fails to put are retried, with
+	// exponential backoff, before the batch fails. Defaults to 6; negative disables retries.
+	MaxRetries int
+	// DeadLetterBucket is the S3 bucket, in FirehoseRegion, that records are written to when they
+	// can't be sent to Firehose. Disabled if empty.
+	DeadLetterBucket string
+	// DeadLetterPrefix is the key prefix for records written to DeadLetterBucket
+	DeadLetterPrefix string
 }
 
 // NewFirehoseSender creates a FirehoseSender
 func NewFirehoseSender(config FirehoseSenderConfig) *FirehoseSender {
 	f := &FirehoseSender{
-		streamName: config.StreamName,
-		deployEnv:  config.DeployEnv,
+		streamName:            config.StreamName,
+		deployEnv:             config.DeployEnv,
+		overridePolicy:        config.ContainerOverridePolicy,
+		overrideAllowlist:     config.ContainerOverrideAllowlist,
+		skipNormalize:         config.SkipContainerNormalization,
+		maxClockSkew:          config.MaxClockSkew,
+		futureTimestampPolicy: config.FutureTimestampPolicy,
+		metricStreamsByType:   config.MetricStreamsByType,
+		metricStreamsByTitle:  config.MetricStreamsByTitle,
+		maxFieldLength:        config.MaxFieldLength,
+		fieldMaxLengths:       config.FieldMaxLengths,
+		blobMinLength:         config.BlobMinLength,
+		blobMinLengths:        config.BlobMinLengths,
+		blobMinEntropy:        config.BlobMinEntropy,
+		hashedFields:          config.HashedFields,
+		hashKey:               config.HashKey,
+		base64Fields:          config.Base64Fields,
+		maxLineLength:         config.MaxLineLength,
+		manifestStream:        config.ManifestStream,
+		flatten:               config.FlattenNested,
+		flattenSeparator:      config.FlattenSeparator,
+		flattenMaxDepth:       config.FlattenMaxDepth,
+		omitRawPolicy:         config.OmitRawFields,
+		delimiter:             config.RecordDelimiter,
+		streamDelimiters:      config.StreamDelimiters,
+		validateKayveeSchema:  config.ValidateKayvee,
+		quarantineStream:      config.QuarantineStream,
+		blankLinePolicy:       config.BlankLinePolicy,
+		blankLinePolicies:     config.BlankLinePolicies,
+		failureSamples:        config.FailureSamples,
+		normalizeInteriorCR:   config.NormalizeInteriorCR,
+		keyValuePrefix:        config.KeyValuePrefix,
+		arrayPayloadField:     config.ArrayPayloadField,
+		arrayPayloadFields:    config.ArrayPayloadFields,
+		oversizedRecordPolicy: config.OversizedRecordPolicy,
+		maxRetries:            config.MaxRetries,
+		sleep:                 time.Sleep,
+		deadLetterBucket:      config.DeadLetterBucket,
+		deadLetterPrefix:      config.DeadLetterPrefix,
+	}
+	if f.maxRetries == 0 {
+		f.maxRetries = defaultMaxRetries
+	}
+
+	stageNames := config.Stages
+	if len(stageNames) == 0 {
+		stageNames = DefaultStages
+	}
+	stages, err := getStages(stageNames)
+	if err != nil {
+		panic(err)
+	}
+	f.stages = stages
+
+	if err := validateDelimiter(config.RecordDelimiter); err != nil {
+		panic(err)
+	}
+	for _, delimiter := range config.StreamDelimiters {
+		if err := validateDelimiter(delimiter); err != nil {
+			panic(err)
+		}
+	}
+	if err := validateBlankLinePolicy(config.BlankLinePolicy); err != nil {
+		panic(err)
+	}
+	for _, policy := range config.BlankLinePolicies {
+		if err := validateBlankLinePolicy(policy); err != nil {
+			panic(err)
+		}
+	}
+
+	if len(config.HaproxyApps) > 0 {
+		f.haproxyApps = map[string]bool{}
+		for _, app := range config.HaproxyApps {
+			f.haproxyApps[app] = true
+		}
+	}
+	if len(config.CompressedStreams) > 0 {
+		f.compressedStreams = map[string]bool{}
+		for _, stream := range config.CompressedStreams {
+			f.compressedStreams[stream] = true
+		}
+	}
+	if len(config.KeyValueApps) > 0 {
+		f.keyValueApps = map[string]bool{}
+		for _, app := range config.KeyValueApps {
+			f.keyValueApps[app] = true
+		}
+	}
+
+	for _, alias := range config.RequestIDAliases {
+		f.requestIDAliases = append(f.requestIDAliases, strings.ToLower(alias))
+	}
+
+	for _, rule := range config.DropRules {
+		compiled, err := newDropRule(rule)
+		if err != nil {
+			panic(err)
+		}
+		f.dropRules = append(f.dropRules, compiled)
+	}
+
+	for _, def := range config.DerivedFields {
+		derived, err := parseDerivedField(def)
+		if err != nil {
+			panic(err)
+		}
+		f.derivedFields = append(f.derivedFields, derived)
+	}
+
+	for _, pattern := range config.ContainerMetaPatterns {
+		f.containerMetaPatterns = append(f.containerMetaPatterns, regexp.MustCompile(pattern))
 	}
 
 	awsConfig := aws.NewConfig().
@@ -49,79 +358,212 @@ func NewFirehoseSender(config FirehoseSenderConfig) *FirehoseSender {
 		WithEndpoint(config.Endpoint)
 	sess := session.Must(session.NewSession(awsConfig))
 	f.client = firehose.New(sess)
+	if config.DeadLetterBucket != "" {
+		s3Sess := session.Must(session.NewSession(aws.NewConfig().WithRegion(config.FirehoseRegion)))
+		f.s3Client = s3.New(s3Sess)
+	}
+
+	if config.InstanceMetaRegion != "" {
+		ec2Sess := session.Must(session.NewSession(aws.NewConfig().WithRegion(config.InstanceMetaRegion)))
+		f.ec2Client = ec2.New(ec2Sess)
+	}
 
 	return f
 }
 
-func (f *FirehoseSender) Initialize(shardID string) {}
+// Initialize records the shard this sender is consuming
+func (f *FirehoseSender) Initialize(shardID string) {
+	f.shardID = shardID
+}
+
+// isKayvee reports whether decode found a Kayvee payload in a log. decode marks these in
+// decoder_msg_type, and leaves the payload's own type field alone.
+func isKayvee(fields map[string]interface{}) bool {
+	return fields["decoder_msg_type"] == "Kayvee"
+}
+
+// Decode parses a raw log line and runs the sender's stages on it, returning the fields that
+// ProcessMessage would send and the Firehose stream it would send them to. Other tools can use it
+// to see exactly what this consumer outputs for a line, without sending anything. Lines that
+// decode rejects are returned as a *DecodeError where the failure can be classified.
+func (f *FirehoseSender) Decode(rawlog []byte) (map[string]interface{}, string, error) {
+	line := normalizeLineEndings(string(rawlog), f.normalizeInteriorCR)
+	fullLine := line
+	truncated := f.maxLineLength > 0 && len(line) > f.maxLineLength
+	if truncated {
+		line = truncateUTF8(line, f.maxLineLength)
+		stats.Counter("truncated-lines", 1)
+	}
+
+	var fields map[string]interface{}
+	var err error
+	if isBlank(line) && f.getBlankLinePolicy("") == BlankLineSkip {
+		// Dropped here, rather than by the blank-lines stage, in case the stages leave it out
+		stats.Counter("blank-lines-skipped", 1)
+		return nil, "", kbc.ErrMessageIgnored
+	} else if isBlank(line) && f.getBlankLinePolicy("") != BlankLineKeep {
+		fields = f.blankLine()
+	} else {
+		fields, err = decode.ParseAndEnhance(line, f.deployEnv)
+	}
+	if err != nil && truncated {
+		// A truncated Kayvee payload is no longer valid JSON, so keep just the syslog fields
+		fields, err = decode.FieldsFromSyslog(line)
+	}
+	if err != nil {
+		return nil, "", classifyDecodeError(line, err)
+	}
+	if truncated {
+		fields["truncated"] = true
+	}
+
+	// Read the Kayvee type before the stages can change it. A truncated line has lost its payload,
+	// so its type is read from the full line.
+	kvType := ""
+	if f.routesMetrics() {
+		kvType = kayveeType(fields)
+		if truncated {
+			if kvFields, err := decode.FieldsFromKayvee(fullLine); err == nil {
+				kvType = kayveeType(kvFields)
+			}
+		}
+	}
+	for _, stage := range f.stages {
+		if err := stage(f, fields); err != nil {
+			if err == kbc.ErrMessageIgnored {
+				stats.LogDropped(fields)
+			}
+			return nil, "", err
+		}
+	}
+
+	stream := f.getStream(fields, kvType)
+	f.omitRawFields(fields)
+
+	return fields, stream, nil
+}
 
 // ProcessMessage processes messages
 func (f *FirehoseSender) ProcessMessage(rawlog []byte) ([]byte, []string, error) {
-	fields, err := decode.ParseAndEnhance(string(rawlog), f.deployEnv)
+	fields, stream, err := f.Decode(rawlog)
 	if err != nil {
+		if err != kbc.ErrMessageIgnored {
+			f.countFailure(rawlog, err)
+		}
 		return nil, nil, err
 	}
+	stats.Counter("decoded", 1)
 
 	msg, err := json.Marshal(fields)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// add newline after each record, so that json objects in firehose will apppear one per line
-	msg = append(msg, '\n')
+	// by default, add newline after each record, so that json objects in firehose will apppear
+	// one per line
+	msg = f.delimit(stream, msg)
+	if len(msg) > maxRecordSize {
+		msg, err = f.fitRecord(fields, stream, msg)
+		if err != nil {
+			f.countFailure(rawlog, err)
+			return nil, nil, err
+		}
+	}
 
-	return msg, []string{f.streamName}, nil
+	return msg, []string{stream}, nil
 }
 
 func (f *FirehoseSender) sendRecords(batch [][]byte, tag string) (
 	*firehose.PutRecordBatchOutput, error,
 ) {
-	awsRecords := make([]*firehose.Record, len(batch))
-	for idx, log := range batch {
-		awsRecords[idx] = &firehose.Record{Data: log}
-	}
+	buf := getRecords(batch)
+	defer putRecords(buf)
 
 	return f.client.PutRecordBatch(&firehose.PutRecordBatchInput{
 		DeliveryStreamName: &tag,
-		Records:            awsRecords,
+		Records:            buf.ptrs,
 	})
 }
 
 // SendBatch sends batches to a firehose
 func (f *FirehoseSender) SendBatch(batch [][]byte, tag string) error {
+	var err error
+	if f.compressedStreams[tag] {
+		err = f.sendCompressedBatch(batch, tag)
+	} else {
+		err = f.sendBatch(batch, tag)
+	}
+	if f.manifestStream != "" {
+		f.sendManifest(batch, tag, err)
+	}
+	if err != nil && f.s3Client != nil && f.sendDeadLetters(batch, tag, err) {
+		// The failed records are safe in S3, so the batch can be checkpointed
+		return nil
+	}
+	return err
+}
+
+// sendCompressedBatch gzips a batch into as few records as possible before sending it
+func (f *FirehoseSender) sendCompressedBatch(batch [][]byte, tag string) error {
+	compressed, err := compressBatch(batch)
+	if err != nil {
+		return kbc.CatastrophicSendBatchError{ErrMessage: err.Error()}
+	}
+	stats.Counter("compressed-records", len(compressed))
+
+	err = f.sendBatch(compressed, tag)
+	if partial, ok := err.(kbc.PartialSendBatchError); ok {
+		partial.FailedMessages = decompressRecords(partial.FailedMessages)
+		return partial
+	}
+	return err
+}
+
+// defaultMaxRetries is how many times records that firehose fails to put are retried, unless
+// configured otherwise
+const defaultMaxRetries = 6
+
+// initialRetryDelay is the backoff before the first retry, which doubles with each retry after it
+const initialRetryDelay = 250 * time.Millisecond
+
+// sendBatch sends a batch, retrying records that firehose fails to put
+func (f *FirehoseSender) sendBatch(batch [][]byte, tag string) error {
 	res, err := f.sendRecords(batch, tag)
 	if err != nil {
 		return kbc.CatastrophicSendBatchError{ErrMessage: err.Error()}
 	}
 
+	pending := batch
 	retries := 0
-	delay := 250
+	delay := initialRetryDelay
 	for *res.FailedPutCount != 0 {
-		log.WarnD("retry-failed-records", logger.M{
-			"stream": tag, "failed-record-count": *res.FailedPutCount, "retries": retries,
-		})
-
-		time.Sleep(time.Duration(delay) * time.Millisecond)
-
-		retryLogs := [][]byte{}
+		// RequestResponses line up with the records in the last call, not the original batch
+		failed := [][]byte{}
 		for idx, entry := range res.RequestResponses {
 			if entry != nil && entry.ErrorMessage != nil && *entry.ErrorMessage != "" {
 				log.ErrorD("failed-record", logger.M{"stream": tag, "msg": &entry.ErrorMessage})
 
-				retryLogs = append(retryLogs, batch[idx])
+				failed = append(failed, pending[idx])
 			}
 		}
-
-		res, err = f.sendRecords(retryLogs, tag)
-		if err != nil {
-			return kbc.CatastrophicSendBatchError{ErrMessage: err.Error()}
-		}
-		if retries > 4 {
+		if retries >= f.maxRetries {
 			return kbc.PartialSendBatchError{
 				ErrMessage:     "Too many retries failed to put records -- stream: " + tag,
-				FailedMessages: retryLogs,
+				FailedMessages: failed,
 			}
 		}
+
+		log.WarnD("retry-failed-records", logger.M{
+			"stream": tag, "failed-record-count": *res.FailedPutCount, "retries": retries,
+		})
+
+		f.sleep(delay)
+
+		res, err = f.sendRecords(failed, tag)
+		if err != nil {
+			return kbc.CatastrophicSendBatchError{ErrMessage: err.Error()}
+		}
+		pending = failed
 		retries++
 		delay *= 2
 	}
@@ -1,8 +1,13 @@
 package sender
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
+	kbc "github.com/Clever/amazon-kinesis-client-go/batchconsumer"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/firehose"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
@@ -13,12 +18,30 @@ func setupFirehoseSender(t *testing.T) *FirehoseSender {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	mockFirehoseAPI := mocks.NewMockFirehoseAPI(mockCtrl)
+	stages, err := getStages(DefaultStages)
+	assert.NoError(t, err)
 	return &FirehoseSender{
 		streamName: "tester",
 		client:     mockFirehoseAPI,
+		stages:     stages,
 	}
 }
 
+// myAppPrefix is the syslog header of a log from the production my-app container, to which tests
+// append a message
+const myAppPrefix = `2017-08-16T04:37:52.901092+00:00 ip-10-0-102-159 production--my-app/` +
+	`arn%3Aaws%3Aecs%3Aus-west-1%3A589690932525%3Atask%2F124cc8a5-0549-4149-922b-cd411b813d11` +
+	`[3252]: `
+
+// decodeOutput runs a log line through ProcessMessage and unmarshals the record it sends
+func decodeOutput(t *testing.T, sender *FirehoseSender, line string) map[string]interface{} {
+	msg, _, err := sender.ProcessMessage([]byte(line))
+	assert.NoError(t, err)
+	out := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(msg, &out))
+	return out
+}
+
 func TestInitFirehoseWriter(t *testing.T) {
 	_ = setupFirehoseSender(t)
 }
@@ -44,3 +67,127 @@ func TestProcessMessageForES(t *testing.T) {
 	_, _, err = sender.ProcessMessage([]byte(msg))
 	assert.NoError(t, err)
 }
+
+func TestDecode(t *testing.T) {
+	sender := setupFirehoseSender(t)
+
+	msg := `2017-08-16T04:37:52.901092+00:00 ip-10-0-102-159 production--my-app/` +
+		`arn%3Aaws%3Aecs%3Aus-west-1%3A589690932525%3Atask%2F124cc8a5-0549-4149-922b-cd411b813d11` +
+		`[3252]: {"title":"request-finished","level":"info"}`
+	fields, stream, err := sender.Decode([]byte(msg))
+	assert.NoError(t, err)
+	assert.Equal(t, "tester", stream)
+	assert.Equal(t, "request-finished", fields["title"])
+	assert.Equal(t, "my-app", fields["container_app"])
+
+	out, _, err := sender.ProcessMessage([]byte(msg))
+	assert.NoError(t, err)
+	expected, err := json.Marshal(fields)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected)+"\n", string(out))
+}
+
+// failRecords returns a PutRecordBatch output failing the records whose data is in failed
+func failRecords(input *firehose.PutRecordBatchInput, failed ...string) *firehose.PutRecordBatchOutput {
+	output := &firehose.PutRecordBatchOutput{FailedPutCount: aws.Int64(0)}
+	for _, record := range input.Records {
+		entry := &firehose.PutRecordBatchResponseEntry{}
+		for _, data := range failed {
+			if string(record.Data) == data {
+				entry.ErrorMessage = aws.String("throttled")
+				*output.FailedPutCount++
+			}
+		}
+		output.RequestResponses = append(output.RequestResponses, entry)
+	}
+	return output
+}
+
+func TestSendBatchRetriesFailedRecords(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockFirehoseAPI := mocks.NewMockFirehoseAPI(mockCtrl)
+
+	sender := setupFirehoseSender(t)
+	sender.client = mockFirehoseAPI
+	sender.maxRetries = 2
+	delays := []time.Duration{}
+	sender.sleep = func(delay time.Duration) { delays = append(delays, delay) }
+
+	sent := [][]string{}
+	mockFirehoseAPI.EXPECT().PutRecordBatch(gomock.Any()).Times(3).DoAndReturn(
+		func(input *firehose.PutRecordBatchInput) (*firehose.PutRecordBatchOutput, error) {
+			call := []string{}
+			for _, record := range input.Records {
+				call = append(call, string(record.Data))
+			}
+			sent = append(sent, call)
+			return failRecords(input, "two", "three"), nil
+		},
+	)
+
+	err := sender.SendBatch([][]byte{[]byte("one"), []byte("two"), []byte("three")}, "tester")
+	assert.Equal(t, [][]string{
+		{"one", "two", "three"},
+		{"two", "three"},
+		{"two", "three"},
+	}, sent)
+	assert.Equal(t, []time.Duration{250 * time.Millisecond, 500 * time.Millisecond}, delays)
+	partial, ok := err.(kbc.PartialSendBatchError)
+	assert.True(t, ok)
+	assert.Equal(t, [][]byte{[]byte("two"), []byte("three")}, partial.FailedMessages)
+}
+
+func TestSendBatchRetrySucceeds(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockFirehoseAPI := mocks.NewMockFirehoseAPI(mockCtrl)
+
+	sender := setupFirehoseSender(t)
+	sender.client = mockFirehoseAPI
+	sender.maxRetries = 1
+	sender.sleep = func(time.Duration) {}
+
+	calls := 0
+	mockFirehoseAPI.EXPECT().PutRecordBatch(gomock.Any()).Times(2).DoAndReturn(
+		func(input *firehose.PutRecordBatchInput) (*firehose.PutRecordBatchOutput, error) {
+			calls++
+			if calls == 1 {
+				return failRecords(input, "two"), nil
+			}
+			assert.Len(t, input.Records, 1)
+			assert.Equal(t, "two", string(input.Records[0].Data))
+			return failRecords(input), nil
+		},
+	)
+
+	err := sender.SendBatch([][]byte{[]byte("one"), []byte("two")}, "tester")
+	assert.NoError(t, err)
+}
+
+func TestNewFirehoseSenderMaxRetries(t *testing.T) {
+	assert.Equal(t, 6, NewFirehoseSender(FirehoseSenderConfig{}).maxRetries)
+	assert.Equal(t, 2, NewFirehoseSender(FirehoseSenderConfig{MaxRetries: 2}).maxRetries)
+	assert.Equal(t, -1, NewFirehoseSender(FirehoseSenderConfig{MaxRetries: -1}).maxRetries)
+}
+
+func TestSendBatchRetriesDisabled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockFirehoseAPI := mocks.NewMockFirehoseAPI(mockCtrl)
+
+	sender := setupFirehoseSender(t)
+	sender.client = mockFirehoseAPI
+	sender.maxRetries = -1
+
+	mockFirehoseAPI.EXPECT().PutRecordBatch(gomock.Any()).Times(1).DoAndReturn(
+		func(input *firehose.PutRecordBatchInput) (*firehose.PutRecordBatchOutput, error) {
+			return failRecords(input, "two"), nil
+		},
+	)
+
+	err := sender.SendBatch([][]byte{[]byte("one"), []byte("two")}, "tester")
+	partial, ok := err.(kbc.PartialSendBatchError)
+	assert.True(t, ok)
+	assert.Equal(t, [][]byte{[]byte("two")}, partial.FailedMessages)
+}
@@ -0,0 +1,57 @@
+package sender
+
+import (
+	"encoding/json"
+)
+
+// defaultFlattenSeparator joins the keys of flattened nested objects
+const defaultFlattenSeparator = "."
+
+// flattenNested replaces nested objects with top-level fields named by their path, e.g.
+// {"nested":{"a":"b"}} becomes {"nested.a":"b"}. Objects deeper than the sender's max depth are
+// kept as JSON strings.
+func (f *FirehoseSender) flattenNested(fields map[string]interface{}) {
+	if !f.flatten {
+		return
+	}
+
+	sep := f.flattenSeparator
+	if sep == "" {
+		sep = defaultFlattenSeparator
+	}
+
+	flat := map[string]interface{}{}
+	for key, val := range fields {
+		f.flattenValue(flat, key, val, sep, 1)
+	}
+
+	for key := range fields {
+		delete(fields, key)
+	}
+	for key, val := range flat {
+		fields[key] = val
+	}
+}
+
+// flattenValue adds val to flat under key, flattening it if it is a non-empty object
+func (f *FirehoseSender) flattenValue(flat map[string]interface{}, key string, val interface{}, sep string, depth int) {
+	nested, ok := val.(map[string]interface{})
+	if !ok || len(nested) == 0 {
+		flat[key] = val
+		return
+	}
+
+	if f.flattenMaxDepth > 0 && depth > f.flattenMaxDepth {
+		data, err := json.Marshal(nested)
+		if err != nil {
+			flat[key] = val
+			return
+		}
+		flat[key] = string(data)
+		return
+	}
+
+	for nestedKey, nestedVal := range nested {
+		f.flattenValue(flat, key+sep+nestedKey, nestedVal, sep, depth+1)
+	}
+}
@@ -0,0 +1,34 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessMessageFlattensNested(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	line := myAppPrefix + `{"title":"request","nested":{"a":"b","deep":{"c":1}},"empty":{},"list":["x","y"]}`
+
+	out := decodeOutput(t, sender, line)
+	assert.Equal(t, map[string]interface{}{
+		"a":    "b",
+		"deep": map[string]interface{}{"c": float64(1)},
+	}, out["nested"])
+
+	sender.flatten = true
+	out = decodeOutput(t, sender, line)
+	assert.Equal(t, "request", out["title"])
+	assert.Equal(t, "b", out["nested.a"])
+	assert.Equal(t, float64(1), out["nested.deep.c"])
+	assert.NotContains(t, out, "nested")
+	assert.Equal(t, map[string]interface{}{}, out["empty"])
+	assert.Equal(t, []interface{}{"x", "y"}, out["list"])
+
+	// Objects deeper than the max depth are kept as JSON strings
+	sender.flattenSeparator = "_"
+	sender.flattenMaxDepth = 1
+	out = decodeOutput(t, sender, line)
+	assert.Equal(t, "b", out["nested_a"])
+	assert.Equal(t, `{"c":1}`, out["nested_deep"])
+}
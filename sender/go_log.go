@@ -0,0 +1,40 @@
+package sender
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// goLogPrefix matches the prefix Go's standard logger writes before a message, e.g.
+// `2017/04/05 21:57:46 some_file.go:10: `, with optional microseconds and file
+var goLogPrefix = regexp.MustCompile(`^\s*(?P<timestamp>\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d{1,6})?)` +
+	`(?: (?P<file>[^\s:]+\.go):(?P<line>\d+):)?`)
+
+// goLogTimestampFormat is the layout of goLogPrefix's timestamp. Go's logger writes local time,
+// but our containers run in UTC.
+const goLogTimestampFormat = "2006/01/02 15:04:05"
+
+// addGoLogPrefix parses a Go standard logger prefix into log_timestamp, caller_file, and
+// caller_line fields. Existing fields are left alone.
+func addGoLogPrefix(fields map[string]interface{}) {
+	prefix, ok := fields["prefix"].(string)
+	if !ok {
+		return
+	}
+
+	matches := namedMatches(goLogPrefix, prefix)
+	if matches == nil {
+		return
+	}
+
+	if timestamp, err := time.Parse(goLogTimestampFormat, matches["timestamp"]); err == nil {
+		setDefault(fields, "log_timestamp", timestamp)
+	}
+	if matches["file"] != "" {
+		setDefault(fields, "caller_file", matches["file"])
+		if line, err := strconv.Atoi(matches["line"]); err == nil {
+			setDefault(fields, "caller_line", line)
+		}
+	}
+}
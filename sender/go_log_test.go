@@ -0,0 +1,32 @@
+package sender
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddGoLogPrefix(t *testing.T) {
+	fields := map[string]interface{}{"prefix": "2017/04/05 21:57:46 some_file.go:10: "}
+	addGoLogPrefix(fields)
+	assert.Equal(t, time.Date(2017, 4, 5, 21, 57, 46, 0, time.UTC), fields["log_timestamp"])
+	assert.Equal(t, "some_file.go", fields["caller_file"])
+	assert.Equal(t, 10, fields["caller_line"])
+
+	fields = map[string]interface{}{"prefix": "2017/04/05 21:57:46.123456 /go/src/app/main.go:42: "}
+	addGoLogPrefix(fields)
+	assert.Equal(t, time.Date(2017, 4, 5, 21, 57, 46, 123456000, time.UTC), fields["log_timestamp"])
+	assert.Equal(t, "/go/src/app/main.go", fields["caller_file"])
+	assert.Equal(t, 42, fields["caller_line"])
+
+	// Timestamp without a file
+	fields = map[string]interface{}{"prefix": "2017/04/05 21:57:46 "}
+	addGoLogPrefix(fields)
+	assert.Contains(t, fields, "log_timestamp")
+	assert.NotContains(t, fields, "caller_file")
+
+	fields = map[string]interface{}{"prefix": "[httpd] "}
+	addGoLogPrefix(fields)
+	assert.Equal(t, map[string]interface{}{"prefix": "[httpd] "}, fields)
+}
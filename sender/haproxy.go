@@ -0,0 +1,58 @@
+package sender
+
+import (
+	"regexp"
+)
+
+// haproxyHTTPLog matches haproxy's HTTP log format, e.g.
+// `10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ----
+// 1/1/1/1/0 0/0 {1wt.eu} {} "GET /index.html HTTP/1.1"`
+var haproxyHTTPLog = regexp.MustCompile(`^(?P<client_ip>\S+):(?P<client_port>\d+) ` +
+	`\[(?P<accept_date>[^\]]+)\] ` +
+	`(?P<frontend_name>\S+) (?P<backend_name>[^/\s]+)/(?P<server_name>\S+) ` +
+	`(?P<tq>-?\d+)/(?P<tw>-?\d+)/(?P<tc>-?\d+)/(?P<tr>-?\d+)/(?P<tt>\+?-?\d+) ` +
+	`(?P<http_status>-?\d+) (?P<bytes_read>\+?\d+) \S+ \S+ (?P<termination_state>\S{4}) ` +
+	`(?P<actconn>\d+)/(?P<feconn>\d+)/(?P<beconn>\d+)/(?P<srv_conn>\d+)/(?P<retries>\+?\d+) ` +
+	`(?P<srv_queue>\d+)/(?P<backend_queue>\d+)` +
+	`(?: \{[^}]*\})*` + // captured request and response headers
+	`(?: "(?P<request_method>\S+) (?P<request>\S+)(?: (?P<http_version>[^"]+))?")?`)
+
+// haproxyIntFields are the haproxy fields which are numbers
+var haproxyIntFields = map[string]bool{
+	"client_port":   true,
+	"tq":            true,
+	"tw":            true,
+	"tc":            true,
+	"tr":            true,
+	"tt":            true,
+	"http_status":   true,
+	"bytes_read":    true,
+	"actconn":       true,
+	"feconn":        true,
+	"beconn":        true,
+	"srv_conn":      true,
+	"retries":       true,
+	"srv_queue":     true,
+	"backend_queue": true,
+}
+
+// parseHaproxy parses the raw log of non-Kayvee logs from the sender's haproxy apps into fields
+func (f *FirehoseSender) parseHaproxy(fields map[string]interface{}) {
+	if len(f.haproxyApps) == 0 || isKayvee(fields) {
+		return
+	}
+	app, ok := fields["container_app"].(string)
+	if !ok || !f.haproxyApps[app] {
+		return
+	}
+	rawlog, ok := fields["rawlog"].(string)
+	if !ok {
+		return
+	}
+
+	matches := namedMatches(haproxyHTTPLog, rawlog)
+	if matches == nil {
+		return
+	}
+	setParsedFields(fields, matches, haproxyIntFields)
+}
@@ -0,0 +1,81 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const haproxyPrefix = `2009-02-06T12:14:14.655000+00:00 ip-10-0-102-159 production--haproxy/` +
+	`arn%3Aaws%3Aecs%3Aus-west-1%3A589690932525%3Atask%2F124cc8a5-0549-4149-922b-cd411b813d11` +
+	`[3252]: `
+
+func TestDecodeHaproxy(t *testing.T) {
+	line := haproxyPrefix + `10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in~ static/srv1 ` +
+		`10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 {1wt.eu} {} "GET /index.html HTTP/1.1"`
+
+	sender := setupFirehoseSender(t)
+	fields, _, err := sender.Decode([]byte(line))
+	assert.NoError(t, err)
+	assert.NotContains(t, fields, "frontend_name")
+
+	sender.haproxyApps = map[string]bool{"haproxy": true}
+	fields, _, err = sender.Decode([]byte(line))
+	assert.NoError(t, err)
+	for field, val := range map[string]interface{}{
+		"client_ip":         "10.0.1.2",
+		"client_port":       33317,
+		"accept_date":       "06/Feb/2009:12:14:14.655",
+		"frontend_name":     "http-in~",
+		"backend_name":      "static",
+		"server_name":       "srv1",
+		"tq":                10,
+		"tw":                0,
+		"tc":                30,
+		"tr":                69,
+		"tt":                109,
+		"http_status":       200,
+		"bytes_read":        2750,
+		"termination_state": "----",
+		"actconn":           1,
+		"feconn":            1,
+		"beconn":            1,
+		"srv_conn":          1,
+		"retries":           0,
+		"srv_queue":         0,
+		"backend_queue":     0,
+		"request_method":    "GET",
+		"request":           "/index.html",
+		"http_version":      "HTTP/1.1",
+	} {
+		assert.Equal(t, val, fields[field], field)
+	}
+	assert.Equal(t, "haproxy", fields["container_app"])
+}
+
+func TestDecodeHaproxyAborted(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	sender.haproxyApps = map[string]bool{"haproxy": true}
+
+	// Aborted requests have -1 timers, and no request line when it wasn't received
+	fields, _, err := sender.Decode([]byte(haproxyPrefix + `10.0.1.2:33320 [06/Feb/2009:12:14:15.000] ` +
+		`http-in static/<NOSRV> -1/-1/-1/-1/+5 -1 0 - - CR-- 2/2/0/0/0 0/0 "<BADREQ>"`))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, fields["tq"])
+	assert.Equal(t, 5, fields["tt"])
+	assert.Equal(t, -1, fields["http_status"])
+	assert.Equal(t, "CR--", fields["termination_state"])
+	assert.NotContains(t, fields, "request_method")
+
+	// haproxy's own messages aren't access logs
+	fields, _, err = sender.Decode([]byte(haproxyPrefix + "Proxy http-in started."))
+	assert.NoError(t, err)
+	assert.NotContains(t, fields, "frontend_name")
+
+	// Nor are Kayvee logs, even when their prefix looks like one
+	fields, _, err = sender.Decode([]byte(haproxyPrefix + `10.0.1.2:33320 [06/Feb/2009:12:14:15.000] ` +
+		`http-in static/<NOSRV> -1/-1/-1/-1/+5 -1 0 - - CR-- 2/2/0/0/0 0/0 {"title":"slow-request"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "slow-request", fields["title"])
+	assert.NotContains(t, fields, "frontend_name")
+}
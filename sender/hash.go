@@ -0,0 +1,65 @@
+package sender
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+)
+
+// hashValue returns the hex HMAC-SHA256 of val
+func hashValue(key []byte, val string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(val))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// hashableString returns the string that a field's value is hashed as, or false for values that
+// aren't hashed
+func hashableString(val interface{}) (string, bool) {
+	switch v := val.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case json.Number:
+		return v.String(), true
+	}
+	return "", false
+}
+
+// isHashedField reports whether path is one of the sender's hashed fields
+func (f *FirehoseSender) isHashedField(path string) bool {
+	for _, hashed := range f.hashedFields {
+		if hashed == path {
+			return true
+		}
+	}
+	return false
+}
+
+// hashFields replaces the values of the configured fields with their keyed hash, so they can
+// still be joined on without storing the raw values. rawlog still holds the raw values, and they
+// can't be reliably found in it by their parsed value, so it is removed from logs with a hashed
+// field.
+func (f *FirehoseSender) hashFields(fields map[string]interface{}) {
+	hashed := false
+	for _, path := range f.hashedFields {
+		parent, key, ok := lookupField(fields, path)
+		if !ok {
+			continue
+		}
+
+		raw, ok := hashableString(parent[key])
+		if !ok {
+			continue
+		}
+		parent[key] = hashValue(f.hashKey, raw)
+		hashed = true
+	}
+
+	if hashed {
+		delete(fields, "rawlog")
+	}
+}
@@ -0,0 +1,56 @@
+package sender
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashFields(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	sender.hashKey = []byte("secret")
+	sender.hashedFields = []string{"user_id", "district.id", "missing"}
+
+	// The user ID also appears in the title and the district ID, which must be left alone
+	line := myAppPrefix + `{"title":"login-42","user_id":"42","district":{"id":1.50,"name":"Springfield 42"}}`
+	out := decodeOutput(t, sender, line)
+
+	assert.Equal(t, hashValue([]byte("secret"), "42"), out["user_id"])
+	assert.Equal(t, "login-42", out["title"])
+	district := out["district"].(map[string]interface{})
+	assert.Equal(t, hashValue([]byte("secret"), "1.5"), district["id"])
+	assert.Equal(t, "Springfield 42", district["name"])
+	assert.NotContains(t, out, "rawlog")
+}
+
+func TestHashFieldsKeepsRawlogWithoutHashedFields(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	sender.hashKey = []byte("secret")
+	sender.hashedFields = []string{"user_id"}
+
+	line := myAppPrefix + `{"title":"request-finished"}`
+	out := decodeOutput(t, sender, line)
+	assert.Equal(t, `{"title":"request-finished"}`, out["rawlog"])
+}
+
+func TestHashValue(t *testing.T) {
+	// Hashes are stable, and depend on the key
+	hashed := hashValue([]byte("secret"), "5f7b1c2d")
+	assert.Equal(t, hashed, hashValue([]byte("secret"), "5f7b1c2d"))
+	assert.NotEqual(t, hashed, hashValue([]byte("other-secret"), "5f7b1c2d"))
+}
+
+func TestHashFieldsLargeIntegers(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	sender.hashedFields = []string{"user_id"}
+	sender.hashKey = []byte("secret")
+
+	fields := map[string]interface{}{
+		"user_id": json.Number("9007199254740993"),
+		"rawlog":  `{"user_id":9007199254740993}`,
+	}
+	sender.hashFields(fields)
+	assert.Equal(t, hashValue([]byte("secret"), "9007199254740993"), fields["user_id"])
+	assert.NotContains(t, fields, "rawlog")
+}
@@ -0,0 +1,132 @@
+package sender
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+)
+
+// instanceMetaTTL is how long an instance's metadata is cached
+const instanceMetaTTL = time.Hour
+
+// instanceMetaErrorTTL is how long a failed lookup is cached, so a broken lookup isn't retried
+// for every log
+const instanceMetaErrorTTL = time.Minute
+
+// maxCachedInstances is the most instances whose metadata is cached. Lookups for new instances
+// are skipped while the cache is full of unexpired entries.
+const maxCachedInstances = 10000
+
+// ec2Hostname matches the default hostname of an EC2 instance, which encodes its private IP,
+// e.g. ip-10-0-102-159
+var ec2Hostname = regexp.MustCompile(`^ip-(\d{1,3})-(\d{1,3})-(\d{1,3})-(\d{1,3})(?:\.|$)`)
+
+// cachedInstanceMeta is the metadata fields for an instance, and when they should be looked up
+// again
+type cachedInstanceMeta struct {
+	fields  map[string]string
+	expires time.Time
+}
+
+// addInstanceMeta adds the EC2 instance ID, availability zone, and instance type of the host
+// that wrote a log, looked up by its syslog hostname. Existing fields are left alone.
+func (f *FirehoseSender) addInstanceMeta(fields map[string]interface{}) {
+	if f.ec2Client == nil {
+		return
+	}
+	hostname, ok := fields["hostname"].(string)
+	if !ok {
+		return
+	}
+
+	for field, val := range f.getInstanceMeta(hostname) {
+		setDefault(fields, field, val)
+	}
+}
+
+// getInstanceMeta returns the cached metadata fields for a hostname. Uncached instances are
+// looked up in the background, so that a slow EC2 API doesn't hold up decoding; their logs
+// don't get the fields until the lookup finishes.
+func (f *FirehoseSender) getInstanceMeta(hostname string) map[string]string {
+	match := ec2Hostname.FindStringSubmatch(hostname)
+	if match == nil {
+		return nil
+	}
+	ip := fmt.Sprintf("%s.%s.%s.%s", match[1], match[2], match[3], match[4])
+
+	f.instanceMetaLock.Lock()
+	defer f.instanceMetaLock.Unlock()
+
+	now := time.Now()
+	if cached, ok := f.instanceMeta[ip]; ok && now.Before(cached.expires) {
+		return cached.fields
+	}
+
+	if f.instanceMeta == nil {
+		f.instanceMeta = map[string]cachedInstanceMeta{}
+	}
+	if len(f.instanceMeta) >= maxCachedInstances {
+		for cachedIP, cached := range f.instanceMeta {
+			if !now.Before(cached.expires) {
+				delete(f.instanceMeta, cachedIP)
+			}
+		}
+		if len(f.instanceMeta) >= maxCachedInstances {
+			return nil
+		}
+	}
+
+	// Until the lookup finishes, it's cached like a failed one so it isn't started again
+	f.instanceMeta[ip] = cachedInstanceMeta{expires: now.Add(instanceMetaErrorTTL)}
+	f.instanceMetaLookups.Add(1)
+	go f.lookupInstanceMeta(ip)
+	return nil
+}
+
+// lookupInstanceMeta looks up the metadata fields for an IP and caches them. Failed lookups, and
+// IPs without an instance, are cached too, so they aren't retried for every log.
+func (f *FirehoseSender) lookupInstanceMeta(ip string) {
+	defer f.instanceMetaLookups.Done()
+
+	meta, err := f.describeInstance(ip)
+	ttl := instanceMetaTTL
+	if err != nil {
+		log.ErrorD("describe-instance", logger.M{"ip": ip, "error": err.Error()})
+		ttl = instanceMetaErrorTTL
+	}
+
+	f.instanceMetaLock.Lock()
+	defer f.instanceMetaLock.Unlock()
+	f.instanceMeta[ip] = cachedInstanceMeta{fields: meta, expires: time.Now().Add(ttl)}
+}
+
+// describeInstance looks up the metadata fields of the instance with a private IP
+func (f *FirehoseSender) describeInstance(ip string) (map[string]string, error) {
+	res, err := f.ec2Client.DescribeInstances(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("private-ip-address"),
+			Values: []*string{aws.String(ip)},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, reservation := range res.Reservations {
+		for _, instance := range reservation.Instances {
+			meta := map[string]string{
+				"ec2_instance_id":   aws.StringValue(instance.InstanceId),
+				"ec2_instance_type": aws.StringValue(instance.InstanceType),
+			}
+			if instance.Placement != nil {
+				meta["ec2_availability_zone"] = aws.StringValue(instance.Placement.AvailabilityZone)
+			}
+			return meta, nil
+		}
+	}
+	return nil, nil
+}
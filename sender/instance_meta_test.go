@@ -0,0 +1,86 @@
+package sender
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Clever/kinesis-to-firehose/mocks"
+)
+
+func TestProcessMessageAddsInstanceMeta(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockEC2API := mocks.NewMockEC2API(mockCtrl)
+
+	sender := setupFirehoseSender(t)
+	sender.ec2Client = mockEC2API
+
+	mockEC2API.EXPECT().DescribeInstances(gomock.Any()).DoAndReturn(
+		func(input *ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+			assert.Equal(t, "10.0.102.159", aws.StringValue(input.Filters[0].Values[0]))
+			return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{
+				Instances: []*ec2.Instance{{
+					InstanceId:   aws.String("i-0123456789abcdef0"),
+					InstanceType: aws.String("m5.large"),
+					Placement:    &ec2.Placement{AvailabilityZone: aws.String("us-west-1a")},
+				}},
+			}}}, nil
+		}).Times(1)
+
+	// The first log is sent without the fields while they're looked up, and later logs get them
+	// from the cache
+	line := `2017-08-16T04:37:52.901092+00:00 ip-10-0-102-159 my-app[3252]: {"title":"a"}`
+	out := decodeOutput(t, sender, line)
+	assert.NotContains(t, out, "ec2_instance_id")
+	sender.instanceMetaLookups.Wait()
+	for idx := 0; idx < 2; idx++ {
+		out = decodeOutput(t, sender, line)
+		assert.Equal(t, "i-0123456789abcdef0", out["ec2_instance_id"])
+		assert.Equal(t, "m5.large", out["ec2_instance_type"])
+		assert.Equal(t, "us-west-1a", out["ec2_availability_zone"])
+	}
+
+	// Failed lookups are cached too
+	mockEC2API.EXPECT().DescribeInstances(gomock.Any()).Return(nil, fmt.Errorf("throttled")).Times(1)
+	line = `2017-08-16T04:37:52.901092+00:00 ip-10-0-1-2.us-west-1.compute.internal my-app[3252]: a`
+	for idx := 0; idx < 2; idx++ {
+		out = decodeOutput(t, sender, line)
+		sender.instanceMetaLookups.Wait()
+		assert.NotContains(t, out, "ec2_instance_id")
+	}
+
+	// Hostnames that aren't EC2 defaults aren't looked up
+	out = decodeOutput(t, sender, `2017-08-16T04:37:52.901092+00:00 influx-service my-app[3252]: a`)
+	assert.NotContains(t, out, "ec2_instance_id")
+}
+
+func TestGetInstanceMetaBoundsCache(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockEC2API := mocks.NewMockEC2API(mockCtrl)
+
+	sender := setupFirehoseSender(t)
+	sender.ec2Client = mockEC2API
+	sender.instanceMeta = map[string]cachedInstanceMeta{}
+	for idx := 0; idx < maxCachedInstances; idx++ {
+		sender.instanceMeta[fmt.Sprintf("ip-%d", idx)] = cachedInstanceMeta{expires: time.Now().Add(time.Hour)}
+	}
+
+	// A full cache of unexpired entries skips new lookups
+	assert.Nil(t, sender.getInstanceMeta("ip-10-0-102-159"))
+	assert.Len(t, sender.instanceMeta, maxCachedInstances)
+
+	// Expired entries are evicted to make room
+	sender.instanceMeta["ip-0"] = cachedInstanceMeta{expires: time.Now().Add(-time.Minute)}
+	mockEC2API.EXPECT().DescribeInstances(gomock.Any()).Return(&ec2.DescribeInstancesOutput{}, nil)
+	assert.Nil(t, sender.getInstanceMeta("ip-10-0-102-159"))
+	sender.instanceMetaLookups.Wait()
+	assert.NotContains(t, sender.instanceMeta, "ip-0")
+	assert.Contains(t, sender.instanceMeta, "10.0.102.159")
+}
@@ -0,0 +1,91 @@
+package sender
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+)
+
+// maxSafeInteger is the largest integer a float64 holds exactly. decode parses Kayvee payloads
+// into float64s, so larger integers, such as 64-bit IDs, get rounded.
+const maxSafeInteger = 1 << 53
+
+// preserveIntegers restores integers in a Kayvee payload that were too large to survive decode's
+// float64s. They're re-read from rawlog as json.Numbers, which marshal unquoted and unrounded.
+func preserveIntegers(fields map[string]interface{}) {
+	if !isKayvee(fields) || !hasUnsafeFloat(fields) {
+		return
+	}
+
+	rawlog, ok := fields["rawlog"].(string)
+	if !ok {
+		return
+	}
+	firstIdx := strings.Index(rawlog, "{")
+	lastIdx := strings.LastIndex(rawlog, "}")
+	if firstIdx == -1 || lastIdx < firstIdx {
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(rawlog[firstIdx : lastIdx+1])))
+	decoder.UseNumber()
+	payload := map[string]interface{}{}
+	if err := decoder.Decode(&payload); err != nil {
+		return
+	}
+	restoreIntegers(fields, payload)
+}
+
+// hasUnsafeFloat returns true if val holds a float64 which may be a rounded integer
+func hasUnsafeFloat(val interface{}) bool {
+	switch v := val.(type) {
+	case float64:
+		return math.Abs(v) >= maxSafeInteger
+	case map[string]interface{}:
+		for _, nested := range v {
+			if hasUnsafeFloat(nested) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, nested := range v {
+			if hasUnsafeFloat(nested) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// restoreIntegers replaces unsafe float64s in decoded with the matching integer json.Numbers
+// in precise, which holds the same payload decoded with json.Decoder.UseNumber
+func restoreIntegers(decoded, precise interface{}) interface{} {
+	switch v := decoded.(type) {
+	case float64:
+		if num, ok := precise.(json.Number); ok && math.Abs(v) >= maxSafeInteger {
+			if _, err := num.Int64(); err == nil {
+				return num
+			}
+		}
+	case map[string]interface{}:
+		preciseMap, ok := precise.(map[string]interface{})
+		if !ok {
+			return decoded
+		}
+		for key, val := range v {
+			if preciseVal, ok := preciseMap[key]; ok {
+				v[key] = restoreIntegers(val, preciseVal)
+			}
+		}
+	case []interface{}:
+		preciseList, ok := precise.([]interface{})
+		if !ok || len(preciseList) != len(v) {
+			return decoded
+		}
+		for idx, val := range v {
+			v[idx] = restoreIntegers(val, preciseList[idx])
+		}
+	}
+	return decoded
+}
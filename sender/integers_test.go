@@ -0,0 +1,30 @@
+package sender
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreserveIntegers(t *testing.T) {
+	sender := setupFirehoseSender(t)
+
+	msg := myAppPrefix + `{"title":"a","id":9007199254740993,"small":42,"ratio":1e300,` +
+		`"nested":{"ids":[9007199254740995,-9007199254740997]}}`
+	out, _, err := sender.ProcessMessage([]byte(msg))
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `"id":9007199254740993`)
+	assert.Contains(t, string(out), `"ids":[9007199254740995,-9007199254740997]`)
+	assert.Contains(t, string(out), `"small":42`)
+	assert.Contains(t, string(out), `"ratio":1e+300`)
+
+	// Payloads without large numbers keep decode's values
+	fields, _, err := sender.Decode([]byte(myAppPrefix + `{"title":"a","count":1}`))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), fields["count"])
+
+	fields, _, err = sender.Decode([]byte(myAppPrefix + `{"title":"a","id":9007199254740993}`))
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number("9007199254740993"), fields["id"])
+}
@@ -0,0 +1,30 @@
+package sender
+
+import (
+	"github.com/Clever/kinesis-to-firehose/sender/stats"
+)
+
+// kayveeRequiredFields are the fields every Kayvee log must have, all of which must be strings
+var kayveeRequiredFields = []string{"title", "source", "level"}
+
+// validateKayvee marks Kayvee logs that are missing a required field, or have one with the wrong
+// type, with kv_invalid=true and lists the offending fields in kv_invalid_fields
+func (f *FirehoseSender) validateKayvee(fields map[string]interface{}) {
+	if !f.validateKayveeSchema || !isKayvee(fields) {
+		return
+	}
+
+	invalid := []string{}
+	for _, field := range kayveeRequiredFields {
+		if _, ok := fields[field].(string); !ok {
+			invalid = append(invalid, field)
+		}
+	}
+	if len(invalid) == 0 {
+		return
+	}
+
+	fields["kv_invalid"] = true
+	fields["kv_invalid_fields"] = invalid
+	stats.Counter("kayvee-invalid", 1)
+}
@@ -0,0 +1,47 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessMessageValidatesKayvee(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	invalid := myAppPrefix + `{"title":"request","level":3}`
+
+	out := decodeOutput(t, sender, invalid)
+	assert.NotContains(t, out, "kv_invalid")
+
+	sender.validateKayveeSchema = true
+	out = decodeOutput(t, sender, invalid)
+	assert.Equal(t, true, out["kv_invalid"])
+	assert.Equal(t, []interface{}{"source", "level"}, out["kv_invalid_fields"])
+
+	out = decodeOutput(t, sender, myAppPrefix+`{"title":"a","source":"b","level":"info"}`)
+	assert.NotContains(t, out, "kv_invalid")
+
+	// Non-Kayvee logs aren't validated
+	out = decodeOutput(t, sender, myAppPrefix+"plain text")
+	assert.NotContains(t, out, "kv_invalid")
+}
+
+func TestProcessMessageQuarantinesInvalidKayvee(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	sender.validateKayveeSchema = true
+	sender.metricStreamsByType = map[string]string{"counter": "counters"}
+	invalid := myAppPrefix + `{"title":"requests","type":"counter"}`
+	valid := myAppPrefix + `{"title":"requests","type":"counter","source":"a","level":"info"}`
+
+	_, tags, err := sender.ProcessMessage([]byte(invalid))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"counters"}, tags)
+
+	sender.quarantineStream = "quarantine"
+	_, tags, err = sender.ProcessMessage([]byte(invalid))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"quarantine"}, tags)
+	_, tags, err = sender.ProcessMessage([]byte(valid))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"counters"}, tags)
+}
@@ -0,0 +1,47 @@
+package sender
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// defaultKeyValuePrefix is prepended to the fields extracted from key=value pairs, so they can't
+// collide with the fields decode adds
+const defaultKeyValuePrefix = "kv_"
+
+// maxKeyValueFields is the most key=value pairs extracted from one log, so that a log with
+// arbitrary keys can't create an unbounded number of fields
+const maxKeyValueFields = 50
+
+// keyValue matches a key=value pair, where the value may be double-quoted, e.g. `status=200` or
+// `msg="request finished"`
+var keyValue = regexp.MustCompile(`(?:^|\s)([A-Za-z_][A-Za-z0-9_.\-]*)=("(?:[^"\\]|\\.)*"|[^\s"]+)`)
+
+// extractKeyValues adds the key=value pairs in the raw log of non-Kayvee logs from the sender's
+// key-value apps as prefixed string fields
+func (f *FirehoseSender) extractKeyValues(fields map[string]interface{}) {
+	if len(f.keyValueApps) == 0 || isKayvee(fields) {
+		return
+	}
+	app, _ := fields["container_app"].(string)
+	if !f.keyValueApps[app] && !f.keyValueApps["*"] {
+		return
+	}
+	rawlog, ok := fields["rawlog"].(string)
+	if !ok {
+		return
+	}
+
+	prefix := f.keyValuePrefix
+	if prefix == "" {
+		prefix = defaultKeyValuePrefix
+	}
+
+	for _, match := range keyValue.FindAllStringSubmatch(rawlog, maxKeyValueFields) {
+		val := match[2]
+		if unquoted, err := strconv.Unquote(val); err == nil {
+			val = unquoted
+		}
+		setDefault(fields, prefix+match[1], val)
+	}
+}
@@ -0,0 +1,43 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const legacyAppPrefix = `2017-08-16T04:37:52.901092+00:00 ip-10-0-102-159 production--legacy-app/` +
+	`arn%3Aaws%3Aecs%3Aus-west-1%3A589690932525%3Atask%2F124cc8a5-0549-4149-922b-cd411b813d11` +
+	`[3252]: `
+
+func TestProcessMessageExtractsKeyValues(t *testing.T) {
+	line := legacyAppPrefix + `level=info msg="request \"finished\"" status=200 path=/health empty= a=b=c`
+
+	sender := setupFirehoseSender(t)
+	out := decodeOutput(t, sender, line)
+	assert.NotContains(t, out, "kv_level")
+
+	sender.keyValueApps = map[string]bool{"legacy-app": true}
+	sender.keyValuePrefix = "kv_"
+	out = decodeOutput(t, sender, line)
+	for field, val := range map[string]string{
+		"kv_level":  "info",
+		"kv_msg":    `request "finished"`,
+		"kv_status": "200",
+		"kv_path":   "/health",
+		"kv_a":      "b=c",
+	} {
+		assert.Equal(t, val, out[field], field)
+	}
+	assert.NotContains(t, out, "kv_empty")
+
+	sender.keyValueApps = map[string]bool{"*": true}
+	sender.keyValuePrefix = "log."
+	out = decodeOutput(t, sender, myAppPrefix+"user_id=42")
+	assert.Equal(t, "42", out["log.user_id"])
+
+	// Kayvee logs are already structured
+	out = decodeOutput(t, sender, myAppPrefix+`{"title":"a"} user_id=42`)
+	assert.Equal(t, "a", out["title"])
+	assert.NotContains(t, out, "log.user_id")
+}
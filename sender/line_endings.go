@@ -0,0 +1,19 @@
+package sender
+
+import (
+	"strings"
+)
+
+// crlf replaces Windows and old Mac line endings with newlines
+var crlf = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// normalizeLineEndings strips trailing CR and LF characters from a raw line, which otherwise end
+// up in rawlog and postfix. If interior is true, CRLF and lone CR line endings inside the line
+// are replaced with LF too.
+func normalizeLineEndings(line string, interior bool) string {
+	line = strings.TrimRight(line, "\r\n")
+	if interior {
+		line = crlf.Replace(line)
+	}
+	return line
+}
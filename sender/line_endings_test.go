@@ -0,0 +1,34 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeLineEndings(t *testing.T) {
+	assert.Equal(t, "a log", normalizeLineEndings("a log\r\n", false))
+	assert.Equal(t, "a log", normalizeLineEndings("a log\n\r\n", false))
+	assert.Equal(t, "a\r\nmultiline\rlog", normalizeLineEndings("a\r\nmultiline\rlog\r", false))
+	assert.Equal(t, "a\nmultiline\nlog", normalizeLineEndings("a\r\nmultiline\rlog\r", true))
+	assert.Equal(t, "a\nlog", normalizeLineEndings("a\nlog", true))
+}
+
+func TestDecodeMixedLineEndings(t *testing.T) {
+	prefix := `2017-08-16T04:37:52.901092+00:00 ip-10-0-102-159 production--my-app/` +
+		`arn%3Aaws%3Aecs%3Aus-west-1%3A589690932525%3Atask%2F124cc8a5-0549-4149-922b-cd411b813d11` +
+		`[3252]: `
+
+	// Events from one CloudWatch Logs batch, written by hosts with different line endings
+	sender := setupFirehoseSender(t)
+	for _, line := range []string{
+		prefix + `{"title":"unix"}` + "\n",
+		prefix + `{"title":"windows"}` + "\r\n",
+		prefix + `{"title":"none"}`,
+	} {
+		fields, _, err := sender.Decode([]byte(line))
+		assert.NoError(t, err)
+		assert.Equal(t, "", fields["postfix"], line)
+		assert.NotContains(t, fields["rawlog"], "\r", line)
+	}
+}
@@ -0,0 +1,69 @@
+package sender
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	kbc "github.com/Clever/amazon-kinesis-client-go/batchconsumer"
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+)
+
+// batchManifest describes a flushed batch, so downstream jobs can reconcile what reached S3
+type batchManifest struct {
+	Type        string `json:"type"`
+	BatchID     string `json:"batch_id"`
+	ShardID     string `json:"shard_id"`
+	Stream      string `json:"stream"`
+	FlushedAt   string `json:"flushed_at"`
+	RecordCount int    `json:"record_count"`
+	ByteSize    int    `json:"byte_size"`
+	FailedCount int    `json:"failed_count"`
+	Status      string `json:"status"`
+}
+
+// sendManifest writes a manifest for a batch sent to stream to the manifest stream. sendErr is
+// the result of sending the batch. Failures are logged rather than returned, so that they don't
+// fail the batch itself.
+func (f *FirehoseSender) sendManifest(batch [][]byte, stream string, sendErr error) {
+	now := time.Now()
+	manifest := batchManifest{
+		Type:        "batch-manifest",
+		BatchID:     fmt.Sprintf("%s-%d", f.shardID, now.UnixNano()),
+		ShardID:     f.shardID,
+		Stream:      stream,
+		FlushedAt:   now.UTC().Format(time.RFC3339Nano),
+		RecordCount: len(batch),
+		Status:      "ok",
+	}
+	for _, record := range batch {
+		manifest.ByteSize += len(record)
+	}
+
+	switch e := sendErr.(type) {
+	case nil:
+	case kbc.PartialSendBatchError:
+		manifest.Status = "partial"
+		manifest.FailedCount = len(e.FailedMessages)
+	default:
+		manifest.Status = "failed"
+		manifest.FailedCount = len(batch)
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		log.ErrorD("marshal-manifest", logger.M{"error": err.Error()})
+		return
+	}
+	data = f.delimit(f.manifestStream, data)
+
+	res, err := f.sendRecords([][]byte{data}, f.manifestStream)
+	if err == nil && *res.FailedPutCount != 0 {
+		err = fmt.Errorf("firehose rejected the manifest record")
+	}
+	if err != nil {
+		log.ErrorD("send-manifest", logger.M{
+			"stream": f.manifestStream, "batch_id": manifest.BatchID, "error": err.Error(),
+		})
+	}
+}
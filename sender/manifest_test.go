@@ -0,0 +1,45 @@
+package sender
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/firehose"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Clever/kinesis-to-firehose/mocks"
+)
+
+func TestSendBatchWritesManifest(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockFirehoseAPI := mocks.NewMockFirehoseAPI(mockCtrl)
+
+	sender := setupFirehoseSender(t)
+	sender.client = mockFirehoseAPI
+	sender.manifestStream = "manifests"
+	sender.Initialize("shard-0001")
+
+	streams := []string{}
+	var manifest batchManifest
+	mockFirehoseAPI.EXPECT().PutRecordBatch(gomock.Any()).Times(2).DoAndReturn(
+		func(input *firehose.PutRecordBatchInput) (*firehose.PutRecordBatchOutput, error) {
+			streams = append(streams, aws.StringValue(input.DeliveryStreamName))
+			if aws.StringValue(input.DeliveryStreamName) == "manifests" {
+				assert.NoError(t, json.Unmarshal(input.Records[0].Data, &manifest))
+			}
+			return &firehose.PutRecordBatchOutput{FailedPutCount: aws.Int64(0)}, nil
+		},
+	)
+
+	err := sender.SendBatch([][]byte{[]byte("one\n"), []byte("three\n")}, "tester")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tester", "manifests"}, streams)
+	assert.Equal(t, "shard-0001", manifest.ShardID)
+	assert.Equal(t, "tester", manifest.Stream)
+	assert.Equal(t, 2, manifest.RecordCount)
+	assert.Equal(t, 10, manifest.ByteSize)
+	assert.Equal(t, "ok", manifest.Status)
+}
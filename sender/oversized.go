@@ -0,0 +1,77 @@
+package sender
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Clever/kinesis-to-firehose/sender/stats"
+)
+
+// Policies for records too large for Firehose
+const (
+	// OversizedDrop drops the record, failing it with ErrRecordTooLarge
+	OversizedDrop = "drop"
+	// OversizedTruncate truncates the record's longest string values until it fits
+	OversizedTruncate = "truncate"
+)
+
+// fitRecord handles a record over maxRecordSize, which would otherwise fail the whole
+// PutRecordBatch call it is part of. It returns the truncated record, or a DecodeError of class
+// ErrRecordTooLarge if it's dropped.
+func (f *FirehoseSender) fitRecord(fields map[string]interface{}, stream string, msg []byte) (
+	[]byte, error,
+) {
+	if f.oversizedRecordPolicy == OversizedTruncate {
+		for len(msg) > maxRecordSize {
+			parent, key, longest := longestString(fields)
+			if parent == nil {
+				break
+			}
+
+			// Shrinking a string by n bytes shrinks its JSON encoding by at least n bytes
+			keep := len(longest) - (len(msg) - maxRecordSize) - len(truncationMarker)
+			if keep < 0 {
+				keep = 0
+			}
+			parent[key] = truncateUTF8(longest, keep) + truncationMarker
+			fields["truncated"] = true
+
+			var err error
+			msg, err = json.Marshal(fields)
+			if err != nil {
+				return nil, err
+			}
+			msg = f.delimit(stream, msg)
+		}
+
+		if len(msg) <= maxRecordSize {
+			stats.Counter("oversized-records-truncated", 1)
+			return msg, nil
+		}
+	}
+
+	return nil, &DecodeError{
+		Class: ErrRecordTooLarge,
+		Err:   fmt.Errorf("record is %d bytes, over the limit of %d", len(msg), maxRecordSize),
+	}
+}
+
+// longestString finds the longest string value that can still be truncated, including in nested
+// objects. It returns the object holding it and its key, or a nil object if there are none.
+func longestString(fields map[string]interface{}) (map[string]interface{}, string, string) {
+	var parent map[string]interface{}
+	var key, longest string
+	for k, val := range fields {
+		switch v := val.(type) {
+		case string:
+			if len(v) > len(truncationMarker) && len(v) > len(longest) {
+				parent, key, longest = fields, k, v
+			}
+		case map[string]interface{}:
+			if p, k, s := longestString(v); p != nil && len(s) > len(longest) {
+				parent, key, longest = p, k, s
+			}
+		}
+	}
+	return parent, key, longest
+}
@@ -0,0 +1,42 @@
+package sender
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessMessageOversizedRecords(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	line := myAppPrefix + `{"title":"big","nested":{"body":"` + strings.Repeat("x", maxRecordSize) + `"}}`
+
+	_, _, err := sender.ProcessMessage([]byte(line))
+	assert.True(t, errors.Is(err, ErrRecordTooLarge))
+
+	// rawlog and the body are both truncated until the record fits
+	sender.oversizedRecordPolicy = OversizedTruncate
+	msg, _, err := sender.ProcessMessage([]byte(line))
+	assert.NoError(t, err)
+	assert.True(t, len(msg) <= maxRecordSize)
+
+	out := decodeOutput(t, sender, line)
+	assert.Equal(t, "big", out["title"])
+	assert.Equal(t, true, out["truncated"])
+	body := out["nested"].(map[string]interface{})["body"].(string)
+	assert.True(t, strings.HasSuffix(body, truncationMarker))
+	assert.True(t, strings.HasSuffix(out["rawlog"].(string), truncationMarker))
+}
+
+func TestLongestString(t *testing.T) {
+	nested := map[string]interface{}{"b": "a longer string value"}
+	fields := map[string]interface{}{"a": "a string value", "nested": nested, "n": 12.0}
+	parent, key, val := longestString(fields)
+	assert.Equal(t, nested, parent)
+	assert.Equal(t, "b", key)
+	assert.Equal(t, "a longer string value", val)
+
+	parent, _, _ = longestString(map[string]interface{}{"short": "x"})
+	assert.Nil(t, parent)
+}
@@ -0,0 +1,55 @@
+package sender
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// postgresLog matches a Postgres log line using RDS's log_line_prefix, `%t:%r:%u@%d:[%p]:`, e.g.
+// `2019-03-10 03:54:59 UTC:10.0.0.123(52834):app@mydb:[20175]:LOG:  duration: 1.234 ms ...`
+var postgresLog = regexp.MustCompile(`(?s)^(?P<postgres_timestamp>\d{4}-\d{2}-\d{2} ` +
+	`\d{2}:\d{2}:\d{2}(?:\.\d+)? [A-Z]+):` +
+	`(?P<postgres_client_addr>\[local\]|[^:(@\s]*|[0-9a-fA-F:]+)(?:\((?P<postgres_client_port>\d+)\))?:` +
+	`(?P<postgres_user>[^@:]*)@(?P<postgres_database>[^:]*):` +
+	`\[(?P<postgres_pid>\d+)\]:` +
+	`(?P<postgres_level>[A-Z0-9]+):\s+(?P<postgres_message>.*)$`)
+
+// postgresStatement matches the duration and statement that Postgres logs for queries, e.g.
+// `duration: 1.234 ms  statement: SELECT 1` or `statement: SELECT 1`
+var postgresStatement = regexp.MustCompile(`(?s)^(?:duration: (?P<duration>[0-9.]+) ms\s*)?` +
+	`(?:(?:statement|(?:execute|parse|bind) [^:]*): (?P<statement>.*))?$`)
+
+// postgresIntFields are the Postgres fields which are numbers
+var postgresIntFields = map[string]bool{
+	"postgres_client_port": true,
+	"postgres_pid":         true,
+}
+
+// parsePostgres parses the raw log of non-Kayvee logs written by Postgres with RDS's
+// log_line_prefix into fields, including query durations and statements
+func parsePostgres(fields map[string]interface{}) {
+	if isKayvee(fields) {
+		return
+	}
+	rawlog, ok := fields["rawlog"].(string)
+	if !ok {
+		return
+	}
+
+	matches := namedMatches(postgresLog, rawlog)
+	if matches == nil {
+		return
+	}
+	setParsedFields(fields, matches, postgresIntFields)
+
+	statement := namedMatches(postgresStatement, matches["postgres_message"])
+	if statement == nil {
+		return
+	}
+	if duration, err := strconv.ParseFloat(statement["duration"], 64); err == nil {
+		setDefault(fields, "postgres_duration_ms", duration)
+	}
+	if statement["statement"] != "" {
+		setDefault(fields, "postgres_statement", statement["statement"])
+	}
+}
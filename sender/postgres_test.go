@@ -0,0 +1,66 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePostgres(t *testing.T) {
+	rawlog := "2019-03-10 03:54:59 UTC:10.0.0.123(52834):app@mydb:[20175]:LOG:  " +
+		"duration: 1.234 ms  statement: SELECT *\nFROM users"
+	fields := map[string]interface{}{"rawlog": rawlog}
+	parsePostgres(fields)
+	assert.Equal(t, map[string]interface{}{
+		"rawlog":               rawlog,
+		"postgres_timestamp":   "2019-03-10 03:54:59 UTC",
+		"postgres_client_addr": "10.0.0.123",
+		"postgres_client_port": 52834,
+		"postgres_user":        "app",
+		"postgres_database":    "mydb",
+		"postgres_pid":         20175,
+		"postgres_level":       "LOG",
+		"postgres_message":     "duration: 1.234 ms  statement: SELECT *\nFROM users",
+		"postgres_duration_ms": 1.234,
+		"postgres_statement":   "SELECT *\nFROM users",
+	}, fields)
+
+	// Background processes have no client, user, or database
+	fields = map[string]interface{}{
+		"rawlog": "2019-03-10 03:55:00 UTC::@:[4321]:LOG:  checkpoint starting: time",
+	}
+	parsePostgres(fields)
+	assert.Equal(t, 4321, fields["postgres_pid"])
+	assert.Equal(t, "checkpoint starting: time", fields["postgres_message"])
+	assert.NotContains(t, fields, "postgres_client_addr")
+	assert.NotContains(t, fields, "postgres_user")
+	assert.NotContains(t, fields, "postgres_duration_ms")
+
+	fields = map[string]interface{}{
+		"rawlog": "2019-03-10 03:55:01 UTC:[local]:app@mydb:[20176]:ERROR:  " +
+			`relation "missing" does not exist`,
+	}
+	parsePostgres(fields)
+	assert.Equal(t, "[local]", fields["postgres_client_addr"])
+	assert.Equal(t, "ERROR", fields["postgres_level"])
+	assert.NotContains(t, fields, "postgres_statement")
+
+	fields = map[string]interface{}{
+		"rawlog": "2019-03-10 03:55:02 UTC:::1(5433):app@mydb:[20177]:LOG:  statement: SELECT 1",
+	}
+	parsePostgres(fields)
+	assert.Equal(t, "::1", fields["postgres_client_addr"])
+	assert.Equal(t, 5433, fields["postgres_client_port"])
+	assert.Equal(t, "SELECT 1", fields["postgres_statement"])
+
+	fields = map[string]interface{}{"rawlog": "not a postgres log"}
+	parsePostgres(fields)
+	assert.Len(t, fields, 1)
+
+	// Kayvee logs aren't parsed
+	fields, _, err := setupFirehoseSender(t).Decode([]byte(myAppPrefix +
+		`2019-03-10 03:55:02 UTC:10.0.0.123(52834):app@mydb:[20177]:LOG:  {"title":"migration"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "migration", fields["title"])
+	assert.NotContains(t, fields, "postgres_level")
+}
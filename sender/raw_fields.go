@@ -0,0 +1,32 @@
+package sender
+
+// Policies for omitting the raw log fields that decode adds to each log
+const (
+	// OmitRawNone keeps rawlog, prefix, and postfix on every log
+	OmitRawNone = "none"
+	// OmitRawKayvee drops rawlog, prefix, and postfix from Kayvee logs, whose fields already hold
+	// everything in them. Non-Kayvee logs keep rawlog.
+	OmitRawKayvee = "kayvee"
+	// OmitRawAll drops rawlog, prefix, and postfix from every log
+	OmitRawAll = "all"
+)
+
+// rawFields are the fields holding the undecoded log line
+var rawFields = []string{"rawlog", "prefix", "postfix"}
+
+// omitRawFields applies the sender's raw-field policy to a log
+func (f *FirehoseSender) omitRawFields(fields map[string]interface{}) {
+	switch f.omitRawPolicy {
+	case OmitRawKayvee:
+		if !isKayvee(fields) {
+			return
+		}
+	case OmitRawAll:
+	default:
+		return
+	}
+
+	for _, field := range rawFields {
+		delete(fields, field)
+	}
+}
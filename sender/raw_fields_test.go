@@ -0,0 +1,30 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessMessageOmitsRawFields(t *testing.T) {
+	kayvee := myAppPrefix + `{"title":"request","type":"counter"}`
+	plain := myAppPrefix + `plain text`
+
+	sender := setupFirehoseSender(t)
+	out := decodeOutput(t, sender, kayvee)
+	assert.Contains(t, out, "rawlog")
+	assert.Contains(t, out, "prefix")
+
+	sender.omitRawPolicy = OmitRawKayvee
+	out = decodeOutput(t, sender, kayvee)
+	assert.Equal(t, "request", out["title"])
+	assert.NotContains(t, out, "rawlog")
+	assert.NotContains(t, out, "prefix")
+	assert.NotContains(t, out, "postfix")
+	out = decodeOutput(t, sender, plain)
+	assert.Equal(t, "plain text", out["rawlog"])
+
+	sender.omitRawPolicy = OmitRawAll
+	out = decodeOutput(t, sender, plain)
+	assert.NotContains(t, out, "rawlog")
+}
@@ -0,0 +1,44 @@
+package sender
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/firehose"
+)
+
+// recordBuffer holds the records for one PutRecordBatch call, so they can be reused by later
+// calls instead of being reallocated for every batch
+type recordBuffer struct {
+	records []firehose.Record
+	ptrs    []*firehose.Record
+}
+
+var recordBuffers = sync.Pool{
+	New: func() interface{} { return &recordBuffer{} },
+}
+
+// getRecords returns a pooled buffer of Firehose records wrapping batch. The buffer must be
+// returned with putRecords once the records have been sent.
+func getRecords(batch [][]byte) *recordBuffer {
+	buf := recordBuffers.Get().(*recordBuffer)
+	if cap(buf.records) < len(batch) {
+		buf.records = make([]firehose.Record, len(batch))
+		buf.ptrs = make([]*firehose.Record, len(batch))
+	}
+	buf.records = buf.records[:len(batch)]
+	buf.ptrs = buf.ptrs[:len(batch)]
+
+	for idx, log := range batch {
+		buf.records[idx] = firehose.Record{Data: log}
+		buf.ptrs[idx] = &buf.records[idx]
+	}
+	return buf
+}
+
+// putRecords returns a buffer to the pool, dropping its references to the batch's data
+func putRecords(buf *recordBuffer) {
+	for idx := range buf.records {
+		buf.records[idx].Data = nil
+	}
+	recordBuffers.Put(buf)
+}
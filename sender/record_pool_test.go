@@ -0,0 +1,22 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRecords(t *testing.T) {
+	buf := getRecords([][]byte{[]byte("one"), []byte("two")})
+	assert.Len(t, buf.ptrs, 2)
+	assert.Equal(t, []byte("one"), buf.ptrs[0].Data)
+	assert.Equal(t, []byte("two"), buf.ptrs[1].Data)
+	putRecords(buf)
+	assert.Nil(t, buf.records[0].Data)
+
+	// A reused buffer only holds the new batch's records
+	buf = getRecords([][]byte{[]byte("three")})
+	assert.Len(t, buf.ptrs, 1)
+	assert.Equal(t, []byte("three"), buf.ptrs[0].Data)
+	putRecords(buf)
+}
@@ -0,0 +1,55 @@
+package sender
+
+import (
+	"strings"
+)
+
+// defaultRequestIDAliases are the field names, lowercased, that producers use for request IDs
+var defaultRequestIDAliases = []string{
+	"req_id",
+	"requestid",
+	"request-id",
+	"x-request-id",
+	"x_request_id",
+}
+
+// normalizeRequestID copies a request ID found under one of the sender's aliases into
+// request_id, so requests can be traced across services. Aliases are matched case-insensitively,
+// and earlier aliases win. An existing request_id is left alone. It runs after hash-fields, so
+// hashed aliases are copied hashed; if request_id is itself hashed, unhashed aliases are hashed
+// as they're copied.
+func (f *FirehoseSender) normalizeRequestID(fields map[string]interface{}) {
+	if _, ok := fields["request_id"]; ok {
+		return
+	}
+
+	aliases := f.requestIDAliases
+	if aliases == nil {
+		aliases = defaultRequestIDAliases
+	}
+
+	var requestID interface{}
+	alias := ""
+	best := len(aliases)
+	for key, val := range fields {
+		lower := strings.ToLower(key)
+		for idx := 0; idx < best; idx++ {
+			if lower == aliases[idx] {
+				requestID, alias, best = val, key, idx
+				break
+			}
+		}
+	}
+	if requestID == nil || requestID == "" {
+		return
+	}
+
+	if f.isHashedField("request_id") && !f.isHashedField(alias) {
+		raw, ok := hashableString(requestID)
+		if !ok {
+			return
+		}
+		requestID = hashValue(f.hashKey, raw)
+	}
+	fields["request_id"] = requestID
+}
@@ -0,0 +1,57 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeRequestID(t *testing.T) {
+	sender := setupFirehoseSender(t)
+
+	for _, fields := range []map[string]interface{}{
+		{"req_id": "abc"},
+		{"requestId": "abc"},
+		{"X-Request-Id": "abc"},
+		{"x_request_id": "other", "X-Request-ID": "abc"},
+	} {
+		sender.normalizeRequestID(fields)
+		assert.Equal(t, "abc", fields["request_id"], fields)
+	}
+
+	fields := map[string]interface{}{"request_id": "mine", "req_id": "abc"}
+	sender.normalizeRequestID(fields)
+	assert.Equal(t, "mine", fields["request_id"])
+
+	fields = map[string]interface{}{"req_id": ""}
+	sender.normalizeRequestID(fields)
+	assert.NotContains(t, fields, "request_id")
+
+	sender.requestIDAliases = []string{"correlation_id"}
+	fields = map[string]interface{}{"req_id": "abc", "Correlation_ID": "def"}
+	sender.normalizeRequestID(fields)
+	assert.Equal(t, "def", fields["request_id"])
+}
+
+func TestProcessMessageHashesRequestIDAliases(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	sender.hashKey = []byte("secret")
+	line := myAppPrefix + `{"title":"a","req_id":"abc"}`
+
+	// A hashed alias is copied hashed
+	sender.hashedFields = []string{"req_id"}
+	out := decodeOutput(t, sender, line)
+	assert.Equal(t, hashValue(sender.hashKey, "abc"), out["req_id"])
+	assert.Equal(t, hashValue(sender.hashKey, "abc"), out["request_id"])
+
+	// An unhashed alias is hashed when request_id is
+	sender.hashedFields = []string{"request_id"}
+	out = decodeOutput(t, sender, line)
+	assert.Equal(t, "abc", out["req_id"])
+	assert.Equal(t, hashValue(sender.hashKey, "abc"), out["request_id"])
+
+	// Both hashed, the alias is only hashed once
+	sender.hashedFields = []string{"req_id", "request_id"}
+	out = decodeOutput(t, sender, line)
+	assert.Equal(t, hashValue(sender.hashKey, "abc"), out["request_id"])
+}
@@ -0,0 +1,41 @@
+package sender
+
+// kayveeMetricTypes are the Kayvee log types which are metrics rather than logs
+var kayveeMetricTypes = map[string]bool{
+	"gauge":   true,
+	"counter": true,
+}
+
+// routesMetrics reports whether any Kayvee metrics are sent to their own streams
+func (f *FirehoseSender) routesMetrics() bool {
+	return len(f.metricStreamsByTitle) > 0 || len(f.metricStreamsByType) > 0
+}
+
+// getStream returns the Firehose stream a log should be sent to. Invalid Kayvee logs go to the
+// quarantine stream, if any. Kayvee metrics, by kvType, go to the stream configured for their
+// title or type, if any; everything else goes to the sender's stream.
+func (f *FirehoseSender) getStream(fields map[string]interface{}, kvType string) string {
+	if f.quarantineStream != "" && fields["kv_invalid"] == true {
+		return f.quarantineStream
+	}
+	if !kayveeMetricTypes[kvType] {
+		return f.streamName
+	}
+
+	if title, ok := fields["title"].(string); ok {
+		if stream, ok := f.metricStreamsByTitle[title]; ok {
+			return stream
+		}
+	}
+	if stream, ok := f.metricStreamsByType[kvType]; ok {
+		return stream
+	}
+	return f.streamName
+}
+
+// kayveeType returns the "type" of a decoded Kayvee log. decode keeps the payload's type as is,
+// since it marks Kayvee logs in decoder_msg_type instead.
+func kayveeType(fields map[string]interface{}) string {
+	kvType, _ := fields["type"].(string)
+	return kvType
+}
@@ -0,0 +1,50 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessMessageRoutesMetrics(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	gauge := myAppPrefix + `{"title":"queue-depth","type":"gauge","value":10}`
+	counter := myAppPrefix + `{"title":"requests","type":"counter","value":1}`
+	plainLog := myAppPrefix + `{"title":"request-finished","level":"info"}`
+
+	// No metric routing by default
+	_, tags, err := sender.ProcessMessage([]byte(gauge))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tester"}, tags)
+
+	sender.metricStreamsByType = map[string]string{"gauge": "gauges", "counter": "counters"}
+	sender.metricStreamsByTitle = map[string]string{"requests": "request-counts"}
+	for line, stream := range map[string]string{
+		gauge:    "gauges",
+		counter:  "request-counts",
+		plainLog: "tester",
+	} {
+		_, tags, err := sender.ProcessMessage([]byte(line))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{stream}, tags, line)
+	}
+}
+
+func TestProcessMessageRoutesTruncatedMetrics(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	sender.metricStreamsByType = map[string]string{"gauge": "gauges"}
+	line := myAppPrefix + `{"title":"queue-depth","type":"gauge","value":10,"tags":"a long list of tags"}`
+
+	// Truncating the line breaks its Kayvee payload
+	sender.maxLineLength = len(line) - 10
+	_, tags, err := sender.ProcessMessage([]byte(line))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gauges"}, tags)
+
+	// Truncating fields changes rawlog
+	sender.maxLineLength = 0
+	sender.maxFieldLength = 20
+	_, tags, err = sender.ProcessMessage([]byte(line))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gauges"}, tags)
+}
@@ -0,0 +1,171 @@
+package sender
+
+import (
+	"fmt"
+
+	kbc "github.com/Clever/amazon-kinesis-client-go/batchconsumer"
+)
+
+// Stage enhances or filters the fields that decode parsed out of a log line. Returning
+// kbc.ErrMessageIgnored drops the log; any other error fails it.
+type Stage func(f *FirehoseSender, fields map[string]interface{}) error
+
+// stages are the stages available to FirehoseSenderConfig.Stages, by name
+var stages = map[string]Stage{
+	"container-meta": func(f *FirehoseSender, fields map[string]interface{}) error {
+		f.addContainerMeta(fields)
+		return nil
+	},
+	"container-overrides": func(f *FirehoseSender, fields map[string]interface{}) error {
+		f.checkContainerOverrides(fields)
+		return nil
+	},
+	"normalize-container-meta": func(f *FirehoseSender, fields map[string]interface{}) error {
+		if !f.skipNormalize {
+			normalizeContainerMeta(fields)
+		}
+		return nil
+	},
+	"blank-lines": func(f *FirehoseSender, fields map[string]interface{}) error {
+		return f.checkBlankLine(fields)
+	},
+	"drop-rules": func(f *FirehoseSender, fields map[string]interface{}) error {
+		if !f.checkDropRules(fields) {
+			return kbc.ErrMessageIgnored
+		}
+		return nil
+	},
+	"preserve-integers": func(f *FirehoseSender, fields map[string]interface{}) error {
+		preserveIntegers(fields)
+		return nil
+	},
+	"kube-meta": func(f *FirehoseSender, fields map[string]interface{}) error {
+		addKubeMeta(fields)
+		return nil
+	},
+	"instance-meta": func(f *FirehoseSender, fields map[string]interface{}) error {
+		f.addInstanceMeta(fields)
+		return nil
+	},
+	"array-payloads": func(f *FirehoseSender, fields map[string]interface{}) error {
+		f.wrapArrayPayload(fields)
+		return nil
+	},
+	"haproxy": func(f *FirehoseSender, fields map[string]interface{}) error {
+		f.parseHaproxy(fields)
+		return nil
+	},
+	"access-log": func(f *FirehoseSender, fields map[string]interface{}) error {
+		parseAccessLog(fields)
+		return nil
+	},
+	"postgres": func(f *FirehoseSender, fields map[string]interface{}) error {
+		parsePostgres(fields)
+		return nil
+	},
+	"api-gateway": func(f *FirehoseSender, fields map[string]interface{}) error {
+		parseAPIGateway(fields)
+		return nil
+	},
+	"key-values": func(f *FirehoseSender, fields map[string]interface{}) error {
+		f.extractKeyValues(fields)
+		return nil
+	},
+	"go-log-prefix": func(f *FirehoseSender, fields map[string]interface{}) error {
+		addGoLogPrefix(fields)
+		return nil
+	},
+	"base64-fields": func(f *FirehoseSender, fields map[string]interface{}) error {
+		f.decodeBase64Fields(fields)
+		return nil
+	},
+	"kayvee-schema": func(f *FirehoseSender, fields map[string]interface{}) error {
+		f.validateKayvee(fields)
+		return nil
+	},
+	"request-ids": func(f *FirehoseSender, fields map[string]interface{}) error {
+		f.normalizeRequestID(fields)
+		return nil
+	},
+	"trace-ids": func(f *FirehoseSender, fields map[string]interface{}) error {
+		addTraceIDs(fields)
+		return nil
+	},
+	"hash-fields": func(f *FirehoseSender, fields map[string]interface{}) error {
+		f.hashFields(fields)
+		return nil
+	},
+	"blobs": func(f *FirehoseSender, fields map[string]interface{}) error {
+		f.replaceBlobFields(fields)
+		return nil
+	},
+	"derived-fields": func(f *FirehoseSender, fields map[string]interface{}) error {
+		f.addDerivedFields(fields)
+		return nil
+	},
+	"flatten-nested": func(f *FirehoseSender, fields map[string]interface{}) error {
+		f.flattenNested(fields)
+		return nil
+	},
+	"truncate-fields": func(f *FirehoseSender, fields map[string]interface{}) error {
+		f.truncateFields("", fields)
+		return nil
+	},
+	"future-timestamps": func(f *FirehoseSender, fields map[string]interface{}) error {
+		if !f.checkTimestamp(fields) {
+			return kbc.ErrMessageIgnored
+		}
+		return nil
+	},
+}
+
+// DefaultStages are the stages run, in order, when FirehoseSenderConfig.Stages is empty
+var DefaultStages = []string{
+	"container-meta",
+	"container-overrides",
+	"normalize-container-meta",
+	"blank-lines",
+	"drop-rules",
+	"preserve-integers",
+	"kube-meta",
+	"instance-meta",
+	"array-payloads",
+	"haproxy",
+	"access-log",
+	"postgres",
+	"api-gateway",
+	"key-values",
+	"go-log-prefix",
+	"base64-fields",
+	"kayvee-schema",
+	"trace-ids",
+	"hash-fields",
+	"request-ids",
+	"future-timestamps",
+	"blobs",
+	"derived-fields",
+	"truncate-fields",
+	"flatten-nested",
+}
+
+// RegisterStage makes a custom stage available to FirehoseSenderConfig.Stages. It must be called
+// before NewFirehoseSender, and panics if a stage with the same name already exists.
+func RegisterStage(name string, stage Stage) {
+	if _, ok := stages[name]; ok {
+		panic(fmt.Sprintf("stage '%s' is already registered", name))
+	}
+	stages[name] = stage
+}
+
+// getStages looks up stages by name, in order
+func getStages(names []string) ([]Stage, error) {
+	found := make([]Stage, len(names))
+	for idx, name := range names {
+		stage, ok := stages[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown stage '%s'", name)
+		}
+		found[idx] = stage
+	}
+	return found, nil
+}
@@ -0,0 +1,36 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetStages(t *testing.T) {
+	_, err := getStages([]string{"container-meta", "not-a-stage"})
+	assert.EqualError(t, err, "unknown stage 'not-a-stage'")
+
+	found, err := getStages(DefaultStages)
+	assert.NoError(t, err)
+	assert.Len(t, found, len(DefaultStages))
+}
+
+func TestCustomStage(t *testing.T) {
+	RegisterStage("test-add-team", func(f *FirehoseSender, fields map[string]interface{}) error {
+		fields["team"] = "eng-infra"
+		return nil
+	})
+	assert.Panics(t, func() { RegisterStage("test-add-team", nil) })
+
+	sender := setupFirehoseSender(t)
+	stages, err := getStages([]string{"test-add-team"})
+	assert.NoError(t, err)
+	sender.stages = stages
+
+	msg := `2017-08-16T04:37:52.901092+00:00 ip-10-0-102-159 production--my-app/` +
+		`arn%3Aaws%3Aecs%3Aus-west-1%3A589690932525%3Atask%2F124cc8a5-0549-4149-922b-cd411b813d11` +
+		`[3252]: {"title":"hello"}`
+	out, _, err := sender.ProcessMessage([]byte(msg))
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `"team":"eng-infra"`)
+}
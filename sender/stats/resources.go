@@ -0,0 +1,47 @@
+package stats
+
+import (
+	"os"
+	"runtime"
+	"time"
+
+	"gopkg.in/Clever/kayvee-go.v6/logger"
+)
+
+// MonitorResources logs the process's goroutine and open file descriptor counts every interval,
+// and warns when either goes over its limit. A limit of zero disables that warning.
+func MonitorResources(interval time.Duration, maxGoroutines, maxOpenFDs int) {
+	go func() {
+		for range time.Tick(interval) {
+			goroutines := runtime.NumGoroutine()
+			openFDs, err := countOpenFDs()
+			if err != nil {
+				log.ErrorD("count-open-fds", logger.M{"error": err.Error()})
+			}
+
+			log.InfoD("resource-usage", logger.M{"goroutines": goroutines, "open_fds": openFDs})
+			if maxGoroutines > 0 && goroutines > maxGoroutines {
+				log.WarnD("too-many-goroutines", logger.M{"goroutines": goroutines, "max": maxGoroutines})
+			}
+			if maxOpenFDs > 0 && openFDs > maxOpenFDs {
+				log.WarnD("too-many-open-fds", logger.M{"open_fds": openFDs, "max": maxOpenFDs})
+			}
+		}
+	}()
+}
+
+// countOpenFDs counts the entries in /proc/self/fd. It only works on Linux.
+func countOpenFDs() (int, error) {
+	dir, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return 0, err
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(-1)
+	if err != nil {
+		return 0, err
+	}
+	// Don't count the descriptor used to read the directory
+	return len(names) - 1, nil
+}
@@ -15,10 +15,18 @@ type datum struct {
 
 var queue = make(chan datum, 2)
 
+type count struct {
+	name  string
+	value int
+}
+
+var counts = make(chan count, 100)
+
 func init() {
 	droppedLogsByApp := map[string]int{}
 	droppedLogsByLevel := map[string]int{}
 	total := 0
+	counters := map[string]int{}
 	tick := time.Tick(time.Minute)
 	go func() {
 		for {
@@ -27,6 +35,8 @@ func init() {
 				droppedLogsByApp[d.app]++
 				droppedLogsByLevel[d.level]++
 				total++
+			case c := <-counts:
+				counters[c.name] += c.value
 			case <-tick:
 				tmp := logger.M{
 					"total_dropped": total,
@@ -39,6 +49,15 @@ func init() {
 				droppedLogsByApp = map[string]int{}
 				droppedLogsByLevel = map[string]int{}
 				total = 0
+
+				if len(counters) > 0 {
+					tmp := logger.M{}
+					for name, val := range counters {
+						tmp[name] = val
+					}
+					log.InfoD("counters", tmp)
+					counters = map[string]int{}
+				}
 			}
 		}
 	}()
@@ -57,3 +76,8 @@ func LogDropped(log map[string]interface{}) {
 
 	queue <- datum{app, level}
 }
+
+// Counter adds val to the named counter. All counters are logged together, and reset, every minute.
+func Counter(name string, val int) {
+	counts <- count{name, val}
+}
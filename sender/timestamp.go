@@ -0,0 +1,39 @@
+package sender
+
+import (
+	"time"
+)
+
+// Policies for logs whose timestamp is further in the future than the sender's max clock skew
+const (
+	// FutureTimestampDrop drops the log
+	FutureTimestampDrop = "drop"
+	// FutureTimestampClamp replaces the log's timestamp with the current time, and keeps the
+	// original in original_timestamp
+	FutureTimestampClamp = "clamp"
+)
+
+// checkTimestamp applies the sender's future-timestamp policy to a log.
+// It returns false if the log should be dropped.
+func (f *FirehoseSender) checkTimestamp(fields map[string]interface{}) bool {
+	if f.maxClockSkew <= 0 {
+		return true
+	}
+
+	timestamp, ok := fields["timestamp"].(time.Time)
+	if !ok {
+		return true
+	}
+
+	now := time.Now()
+	if !timestamp.After(now.Add(f.maxClockSkew)) {
+		return true
+	}
+
+	if f.futureTimestampPolicy == FutureTimestampClamp {
+		fields["original_timestamp"] = timestamp
+		fields["timestamp"] = now
+		return true
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package sender
+
+import (
+	"testing"
+	"time"
+
+	kbc "github.com/Clever/amazon-kinesis-client-go/batchconsumer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckTimestamp(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	future := time.Now().Add(time.Hour)
+
+	// Disabled by default
+	fields := map[string]interface{}{"timestamp": future}
+	assert.True(t, sender.checkTimestamp(fields))
+	assert.Equal(t, future, fields["timestamp"])
+
+	sender.maxClockSkew = 5 * time.Minute
+	assert.True(t, sender.checkTimestamp(map[string]interface{}{"timestamp": time.Now()}))
+	assert.False(t, sender.checkTimestamp(map[string]interface{}{"timestamp": future}))
+
+	sender.futureTimestampPolicy = FutureTimestampClamp
+	fields = map[string]interface{}{"timestamp": future}
+	assert.True(t, sender.checkTimestamp(fields))
+	assert.Equal(t, future, fields["original_timestamp"])
+	assert.True(t, fields["timestamp"].(time.Time).Before(future))
+}
+
+func TestProcessMessageDropsFutureTimestamps(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	sender.maxClockSkew = 5 * time.Minute
+
+	msg := `2099-08-16T04:37:52.901092+00:00 ip-10-0-102-159 production--my-app/` +
+		`arn%3Aaws%3Aecs%3Aus-west-1%3A589690932525%3Atask%2F124cc8a5-0549-4149-922b-cd411b813d11` +
+		`[3252]: {"title":"from-the-future"}`
+	_, _, err := sender.ProcessMessage([]byte(msg))
+	assert.Equal(t, kbc.ErrMessageIgnored, err)
+}
@@ -0,0 +1,72 @@
+package sender
+
+import (
+	"regexp"
+	"strings"
+)
+
+// amznTraceID matches an X-Amzn-Trace-Id header value, e.g.
+// `Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1`
+var amznTraceID = regexp.MustCompile(`Root=(?P<trace>1-[0-9a-f]{8}-[0-9a-f]{24})` + // trace-id
+	`(;Parent=(?P<span>[0-9a-f]{16}))?`) // optional span-id
+
+// traceparent matches a W3C traceparent header value, e.g.
+// `00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01`
+var traceparent = regexp.MustCompile(`\b[0-9a-f]{2}-(?P<trace>[0-9a-f]{32})-(?P<span>[0-9a-f]{16})-[0-9a-f]{2}\b`)
+
+// traceHeaderFields are the fields that may hold tracing headers, by lowercased name
+var traceHeaderFields = map[string]*regexp.Regexp{
+	"x-amzn-trace-id": amznTraceID,
+	"x_amzn_trace_id": amznTraceID,
+	"amzn_trace_id":   amznTraceID,
+	"traceparent":     traceparent,
+}
+
+// addTraceIDs normalizes tracing headers found in a log into trace_id and span_id fields.
+// It looks at Kayvee _kvmeta, then header fields, then the raw log. Existing trace_id and span_id
+// fields are left alone.
+func addTraceIDs(fields map[string]interface{}) {
+	if _, ok := fields["trace_id"]; ok {
+		return
+	}
+
+	if meta, ok := fields["_kvmeta"].(map[string]interface{}); ok {
+		if trace, ok := meta["trace_id"].(string); ok && trace != "" {
+			fields["trace_id"] = trace
+			if span, ok := meta["span_id"].(string); ok && span != "" {
+				setDefault(fields, "span_id", span)
+			}
+			return
+		}
+	}
+
+	for field, val := range fields {
+		re, ok := traceHeaderFields[strings.ToLower(field)]
+		if !ok {
+			continue
+		}
+		if str, ok := val.(string); ok && addTraceMatch(fields, re, str) {
+			return
+		}
+	}
+
+	if rawlog, ok := fields["rawlog"].(string); ok {
+		if !addTraceMatch(fields, amznTraceID, rawlog) {
+			addTraceMatch(fields, traceparent, rawlog)
+		}
+	}
+}
+
+// addTraceMatch sets trace_id and span_id from the first match of re in s
+func addTraceMatch(fields map[string]interface{}, re *regexp.Regexp, s string) bool {
+	groups := namedMatches(re, s)
+	if groups == nil {
+		return false
+	}
+
+	fields["trace_id"] = groups["trace"]
+	if groups["span"] != "" {
+		setDefault(fields, "span_id", groups["span"])
+	}
+	return true
+}
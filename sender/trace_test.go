@@ -0,0 +1,67 @@
+package sender
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddTraceIDs(t *testing.T) {
+	tests := []struct {
+		fields map[string]interface{}
+		trace  string
+		span   string
+	}{
+		{
+			fields: map[string]interface{}{
+				"X-Amzn-Trace-Id": "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1",
+			},
+			trace: "1-5759e988-bd862e3fe1be46a994272793",
+			span:  "53995c3f42cd8ad8",
+		},
+		{
+			fields: map[string]interface{}{
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			trace: "4bf92f3577b34da6a3ce929d0e0e4736",
+			span:  "00f067aa0ba902b7",
+		},
+		{
+			fields: map[string]interface{}{
+				"_kvmeta": map[string]interface{}{"trace_id": "abc", "span_id": "def"},
+			},
+			trace: "abc",
+			span:  "def",
+		},
+		{
+			fields: map[string]interface{}{
+				"rawlog": "GET /health 200 Root=1-5759e988-bd862e3fe1be46a994272793;Sampled=0",
+			},
+			trace: "1-5759e988-bd862e3fe1be46a994272793",
+		},
+		{
+			fields: map[string]interface{}{
+				"trace_id":    "already-set",
+				"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			trace: "already-set",
+		},
+		{
+			fields: map[string]interface{}{"rawlog": "nothing to see here"},
+		},
+	}
+
+	for _, test := range tests {
+		addTraceIDs(test.fields)
+		if test.trace == "" {
+			assert.NotContains(t, test.fields, "trace_id")
+		} else {
+			assert.Equal(t, test.trace, test.fields["trace_id"])
+		}
+		if test.span == "" {
+			assert.NotContains(t, test.fields, "span_id")
+		} else {
+			assert.Equal(t, test.span, test.fields["span_id"])
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package sender
+
+import (
+	"unicode/utf8"
+
+	"github.com/Clever/kinesis-to-firehose/sender/stats"
+)
+
+// truncationMarker is appended to string values that were cut short
+const truncationMarker = "...[truncated]"
+
+// truncateUTF8 shortens s to at most n bytes without splitting a multi-byte character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// truncateFields shortens string values longer than their field's max length, including in
+// nested objects. Nested fields are configured by their dotted path, e.g. "error.stack".
+func (f *FirehoseSender) truncateFields(prefix string, fields map[string]interface{}) {
+	if f.maxFieldLength <= 0 && len(f.fieldMaxLengths) == 0 {
+		return
+	}
+
+	for key, val := range fields {
+		path := prefix + key
+		switch v := val.(type) {
+		case map[string]interface{}:
+			f.truncateFields(path+".", v)
+		case string:
+			max, ok := f.fieldMaxLengths[path]
+			if !ok {
+				max = f.maxFieldLength
+			}
+			if max > 0 && len(v) > max {
+				fields[key] = truncateUTF8(v, max) + truncationMarker
+				stats.Counter("truncated-fields", 1)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package sender
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateUTF8(t *testing.T) {
+	assert.Equal(t, "short", truncateUTF8("short", 10))
+	assert.Equal(t, "abc", truncateUTF8("abcdef", 3))
+	// "é" is two bytes, so cutting through it backs off to the previous character
+	assert.Equal(t, "ab", truncateUTF8("abéd", 3))
+}
+
+func TestProcessMessageTruncatesFields(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	stack := strings.Repeat("x", 100)
+	line := myAppPrefix + `{"title":"panic","stack":"` + stack + `","error":{"stack":"` + stack + `"},"count":12345}`
+
+	out := decodeOutput(t, sender, line)
+	assert.Equal(t, stack, out["stack"])
+
+	sender.maxFieldLength = 10
+	sender.fieldMaxLengths = map[string]int{"error.stack": 20, "title": 0, "rawlog": 0}
+	out = decodeOutput(t, sender, line)
+	assert.Equal(t, "panic", out["title"])
+	assert.Equal(t, strings.Repeat("x", 10)+truncationMarker, out["stack"])
+	assert.Equal(t, strings.Repeat("x", 20)+truncationMarker, out["error"].(map[string]interface{})["stack"])
+	assert.Equal(t, float64(12345), out["count"])
+	assert.Contains(t, out["rawlog"], stack)
+}
+
+func TestProcessMessageTruncatesLongLines(t *testing.T) {
+	sender := setupFirehoseSender(t)
+	sender.maxLineLength = 250
+
+	msg := myAppPrefix + `{"title":"big","nested":{"a":"b"},"stack":"` + strings.Repeat("x", 500) + `"}`
+	out, _, err := sender.ProcessMessage([]byte(msg))
+	assert.NoError(t, err)
+
+	fields := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(out, &fields))
+	assert.Equal(t, true, fields["truncated"])
+	assert.Equal(t, "my-app", fields["container_app"])
+	assert.NotContains(t, fields, "title")
+	assert.True(t, len(fields["rawlog"].(string)) < 250)
+}